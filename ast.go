@@ -0,0 +1,528 @@
+// -*- coding: utf-8 -*-
+
+// Created on Sat Oct 17 04:22:17 PM EDT 2026
+// author: Ryan Hildebrandt, github.com/ryancahildebrandt
+
+package gsgf
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bzick/tokenizer"
+)
+
+// Node of the syntax tree of a rule expansion, see ParseExpansion
+// Nodes are one of *Sequence, *Alternatives, *Group, *Optional, *RuleRef, *Literal, *Tag, *Weight, or *Repeat
+type Node interface {
+	// Returns the position of the first token of the node
+	Position() Position
+	// Adds the edges of the node to the rule graph e, entering from graph node from, and returns the graph node the following item continues from
+	edges(e *EdgeList, from int) int
+}
+
+// Items following each other in an expansion, such as the words, rule references, and groups of one alternative
+type Sequence struct {
+	Pos   Position
+	Items []Node
+}
+
+// Alternatives separated by |, each of which is a *Sequence or a *Weight applied to one
+type Alternatives struct {
+	Pos   Position
+	Items []Node
+}
+
+// Required group in parentheses, as in (a | b)
+// Body is a *Sequence or *Alternatives
+type Group struct {
+	Pos   Position
+	Body  Node
+	open  int
+	close int
+}
+
+// Optional group in square brackets, as in [a | b]
+// Body is a *Sequence or *Alternatives
+type Optional struct {
+	Pos   Position
+	Body  Node
+	open  int
+	close int
+}
+
+// Reference to another rule, including angle brackets, as in <rule> or <gram.rule>
+type RuleRef struct {
+	Pos   Position
+	Name  string
+	token int
+}
+
+// Text of an expansion, with surrounding whitespace removed
+// Text is empty for whitespace between groups and rule references, which is kept as a node of the rule graph
+type Literal struct {
+	Pos   Position
+	Text  string
+	token int
+}
+
+// Tag in curly braces, as in small {size}
+// Item is the *Literal or *Tag the tag follows within the same text, or nil for a tag following a group or rule reference
+type Tag struct {
+	Pos   Position
+	Text  string
+	Item  Node
+	token int
+}
+
+// Weight between slashes, as in /10/ a | /1/ b
+// - Item is the alternative following a weight at the start of an alternative, or the *Literal or *Tag preceding a weight within the same text
+// - Item is nil if the weight does not apply to anything
+type Weight struct {
+	Pos   Position
+	Value float64
+	Item  Node
+	token int
+}
+
+// Item repeated by * or +
+// - Min is 0 for *, which allows the item to be skipped, and 1 for +
+// - Item is nil if the operator does not follow a word, rule reference, tag, or group
+type Repeat struct {
+	Pos   Position
+	Item  Node
+	Min   int
+	token int
+}
+
+func (n *Sequence) Position() Position     { return n.Pos }
+func (n *Alternatives) Position() Position { return n.Pos }
+func (n *Group) Position() Position        { return n.Pos }
+func (n *Optional) Position() Position     { return n.Pos }
+func (n *RuleRef) Position() Position      { return n.Pos }
+func (n *Literal) Position() Position      { return n.Pos }
+func (n *Tag) Position() Position          { return n.Pos }
+func (n *Weight) Position() Position       { return n.Pos }
+func (n *Repeat) Position() Position       { return n.Pos }
+
+func (n *Sequence) edges(e *EdgeList, from int) int {
+	for _, item := range n.Items {
+		from = item.edges(e, from)
+	}
+
+	return from
+}
+
+func (n *Alternatives) edges(e *EdgeList, from int) int {
+	exits := alternativeEdges(n, e, from)
+
+	return exits[len(exits)-1]
+}
+
+func (n *Group) edges(e *EdgeList, from int) int {
+	*e = append(*e, Edge{From: from, To: n.open, Weight: 1.0})
+
+	return groupEdges(n.Body, e, n.open, n.close)
+}
+
+func (n *Optional) edges(e *EdgeList, from int) int {
+	*e = append(*e, Edge{From: from, To: n.open, Weight: 1.0})
+	if n.close >= 0 {
+		*e = append(*e, Edge{From: n.open, To: n.close, Weight: 1.0})
+	}
+
+	return groupEdges(n.Body, e, n.open, n.close)
+}
+
+func (n *RuleRef) edges(e *EdgeList, from int) int {
+	*e = append(*e, Edge{From: from, To: n.token, Weight: 1.0})
+
+	return n.token
+}
+
+func (n *Literal) edges(e *EdgeList, from int) int {
+	*e = append(*e, Edge{From: from, To: n.token, Weight: 1.0})
+
+	return n.token
+}
+
+func (n *Tag) edges(e *EdgeList, from int) int {
+	*e = append(*e, Edge{From: from, To: n.token, Weight: 1.0})
+
+	return n.token
+}
+
+func (n *Weight) edges(e *EdgeList, from int) int {
+	*e = append(*e, Edge{From: from, To: n.token, Weight: 1.0})
+	if n.Item == nil || firstToken(n.Item) == n.token {
+		return n.token
+	}
+
+	return n.Item.edges(e, n.token)
+}
+
+func (n *Repeat) edges(e *EdgeList, from int) int {
+	if n.Item == nil {
+		*e = append(*e, Edge{From: from, To: n.token, Weight: 1.0})
+		return n.token
+	}
+	exit := n.Item.edges(e, from)
+	*e = append(*e, Edge{From: exit, To: n.token, Weight: 1.0})
+	*e = append(*e, Edge{From: exit, To: firstToken(n.Item), Weight: 1.0})
+	if n.Min == 0 {
+		*e = append(*e, Edge{From: from, To: n.token, Weight: 1.0})
+	}
+
+	return n.token
+}
+
+// Helper function to add the edges of each alternative of n entering from graph node from, returning the graph node each alternative ends at
+func alternativeEdges(n Node, e *EdgeList, from int) []int {
+	var exits []int
+
+	alt, ok := n.(*Alternatives)
+	if !ok {
+		return []int{n.edges(e, from)}
+	}
+	for _, item := range alt.Items {
+		exits = append(exits, item.edges(e, from))
+	}
+
+	return exits
+}
+
+// Helper function to add the edges of the body of a group between its brackets at graph nodes open and close
+// If the group is not closed, the group continues from the end of its last alternative
+func groupEdges(n Node, e *EdgeList, open int, close int) int {
+	exits := alternativeEdges(n, e, open)
+	if close < 0 {
+		return exits[len(exits)-1]
+	}
+	for _, exit := range exits {
+		*e = append(*e, Edge{From: exit, To: close, Weight: 1.0})
+	}
+
+	return close
+}
+
+// Returns the graph node that repeating n loops back to, or -1 if n is not a single word, rule reference, tag, weight, or group
+func firstToken(n Node) int {
+	switch n := n.(type) {
+	case *RuleRef:
+		return n.token
+	case *Literal:
+		return n.token
+	case *Tag:
+		return n.token
+	case *Weight:
+		return n.token
+	case *Group:
+		return n.open
+	case *Optional:
+		return n.open
+	default:
+		return -1
+	}
+}
+
+// Calls f for n and each of its descendants in depth first order, which is the order they appear in the expansion
+// The children of a node are skipped if f returns false for it
+func Walk(n Node, f func(Node) bool) {
+	if n == nil || !f(n) {
+		return
+	}
+	switch n := n.(type) {
+	case *Sequence:
+		for _, item := range n.Items {
+			Walk(item, f)
+		}
+	case *Alternatives:
+		for _, item := range n.Items {
+			Walk(item, f)
+		}
+	case *Group:
+		Walk(n.Body, f)
+	case *Optional:
+		Walk(n.Body, f)
+	case *Tag:
+		Walk(n.Item, f)
+	case *Weight:
+		Walk(n.Item, f)
+	case *Repeat:
+		Walk(n.Item, f)
+	}
+}
+
+// Parses a rule expansion, such as "i want <size> [tea | coffee];", into its syntax tree
+// Nodes are positioned on line 1, at the column of their first token in e
+// Returns the tree along with an ErrorList if the expansion has unbalanced brackets, repetition operators that do not follow an item, or invalid weights
+func ParseExpansion(e Expression, lex *tokenizer.Tokenizer) (Node, error) {
+	tokens, spans := ToTokenSpans(e, lex)
+	pos := make([]Position, len(spans))
+	for i, span := range spans {
+		pos[i] = Position{Line: 1, Column: utf8.RuneCountInString(e[:span.Start]) + 1}
+	}
+
+	n, err := parseTokens(tokens, pos, referenceTokens(e, tokens, spans))
+
+	return n, unclosedLiterals(e, tokens, spans, pos, getQuoteChar(lex), err)
+}
+
+// Returns err along with an error at each quote of expression e that starts a literal without closing it, which ToTokenSpans keeps as a token of its own
+// Errors are positioned at the position of the quote's token in pos, if available
+func unclosedLiterals(e Expression, tokens []Expression, spans []Span, pos []Position, q string, err error) error {
+	var errs ErrorList
+
+	for i, t := range tokens {
+		if q == "" || t != q || i >= len(spans) || e[spans[i].Start:spans[i].End] != q {
+			continue
+		}
+		var p Position
+		if i < len(pos) {
+			p = pos[i]
+		}
+		errs = append(errs, &SourceError{Pos: p, Msg: "unclosed literal", Text: q, Err: ErrInvalidRule})
+	}
+	if err != nil {
+		errs.add(err, Position{}, "")
+	}
+
+	return errs.err()
+}
+
+// Returns the edges of the graph of a rule expansion from its syntax tree, where tokens are the tokens the tree was parsed from
+// Each alternative at the top level of the expansion ends at the closing semicolon, if there is one
+func treeEdges(n Node, tokens []Expression) EdgeList {
+	var e EdgeList
+
+	if len(tokens) == 0 {
+		return e
+	}
+	end := len(tokens) - 1
+	exits := alternativeEdges(n, &e, 0)
+	if end > 1 && tokens[end-1] == ";" {
+		for _, exit := range exits {
+			e = append(e, Edge{From: exit, To: end - 1, Weight: 1.0})
+		}
+		e = append(e, Edge{From: end - 1, To: end, Weight: 1.0})
+	} else {
+		e = append(e, Edge{From: exits[len(exits)-1], To: end, Weight: 1.0})
+	}
+
+	return Unique(e)
+}
+
+// Reads the tokens of a rule expansion, as returned by ToTokens, into a syntax tree
+type treeParser struct {
+	tokens []Expression
+	pos    []Position
+	refs   []bool
+	i      int
+	errs   ErrorList
+}
+
+// Parses the tokens of a rule expansion into its syntax tree, positioning each node at the position of its first token in pos, if available
+// Tokens marked in refs are read as rule references, see referenceTokens. If refs is nil, every token of the form <rule> is read as a reference
+// Parsing continues past errors, so that the tree covers every token of the expansion
+// Returns the tree along with an ErrorList if the expansion has unbalanced brackets, repetition operators that do not follow an item, or invalid weights
+func parseTokens(tokens []Expression, pos []Position, refs []bool) (Node, error) {
+	if len(tokens) == 0 {
+		return &Sequence{}, nil
+	}
+
+	p := &treeParser{tokens: tokens, pos: pos, refs: refs, i: 1}
+	n := p.alternatives("")
+	for ; p.i < len(p.tokens); p.i++ {
+		if p.tokens[p.i] != ";" && p.tokens[p.i] != "<EOS>" {
+			p.fail(p.i, "unexpected token", ErrInvalidRule)
+		}
+	}
+
+	return n, p.errs.err()
+}
+
+// Returns the position of token i, or an empty position if it is not known
+func (p *treeParser) position(i int) Position {
+	if i < 0 || i >= len(p.pos) {
+		return Position{}
+	}
+
+	return p.pos[i]
+}
+
+// Records an error at token i
+func (p *treeParser) fail(i int, msg string, err error) {
+	p.errs = append(p.errs, &SourceError{Pos: p.position(i), Msg: msg, Text: strings.TrimSpace(p.tokens[i]), Err: err})
+}
+
+// Parses | separated alternatives up to, but not including, the closing bracket c or the end of the expansion
+func (p *treeParser) alternatives(c Expression) Node {
+	var (
+		alts []Node
+		seq  *Sequence = &Sequence{}
+	)
+
+	for p.i < len(p.tokens) {
+		t := p.tokens[p.i]
+		switch t {
+		case "|":
+			alts = append(alts, p.alternative(seq))
+			seq = &Sequence{}
+			p.i++
+		case ")", "]":
+			if t == c {
+				return p.join(alts, seq)
+			}
+			p.fail(p.i, "unmatched closing bracket", ErrInvalidRule)
+			p.i++
+		case ";", "<EOS>":
+			return p.join(alts, seq)
+		case "(", "[":
+			seq.Items = append(seq.Items, p.group())
+		case "*", "+":
+			seq.Items = p.repeat(seq.Items)
+			p.i++
+		default:
+			seq.Items = append(seq.Items, p.leaf())
+			p.i++
+		}
+	}
+
+	return p.join(alts, seq)
+}
+
+// Helper function to combine the alternatives read so far with the last one, returning the last one alone if there is only one
+func (p *treeParser) join(alts []Node, seq *Sequence) Node {
+	last := p.alternative(seq)
+	if len(alts) == 0 {
+		return last
+	}
+	alts = append(alts, last)
+
+	return &Alternatives{Pos: alts[0].Position(), Items: alts}
+}
+
+// Completes the sequence of an alternative, applying a weight at the start of the alternative to the rest of it
+func (p *treeParser) alternative(seq *Sequence) Node {
+	if len(seq.Items) == 0 {
+		seq.Pos = p.position(p.i)
+		return seq
+	}
+	seq.Pos = seq.Items[0].Position()
+	w, ok := seq.Items[0].(*Weight)
+	if !ok || w.Item != nil {
+		return seq
+	}
+	w.Item = &Sequence{Pos: p.position(w.token + 1), Items: seq.Items[1:]}
+	if len(seq.Items) > 1 {
+		w.Item = &Sequence{Pos: seq.Items[1].Position(), Items: seq.Items[1:]}
+	}
+
+	return w
+}
+
+// Parses a group or optional group starting at the current token
+func (p *treeParser) group() Node {
+	var (
+		open  int        = p.i
+		close int        = -1
+		c     Expression = ")"
+	)
+
+	if p.tokens[open] == "[" {
+		c = "]"
+	}
+	p.i++
+	body := p.alternatives(c)
+	if p.i < len(p.tokens) && p.tokens[p.i] == c {
+		close = p.i
+		p.i++
+	} else {
+		p.fail(open, "unclosed group", ErrInvalidRule)
+	}
+	if c == "]" {
+		return &Optional{Pos: p.position(open), Body: body, open: open, close: close}
+	}
+
+	return &Group{Pos: p.position(open), Body: body, open: open, close: close}
+}
+
+// Applies the repetition operator at the current token to the last item of a sequence
+func (p *treeParser) repeat(items []Node) []Node {
+	n := &Repeat{Pos: p.position(p.i), Min: 0, token: p.i}
+	if p.tokens[p.i] == "+" {
+		n.Min = 1
+	}
+	if len(items) == 0 || firstToken(items[len(items)-1]) < 0 {
+		p.fail(p.i, "repetition operator does not follow an item", ErrInvalidRule)
+		return append(items, n)
+	}
+	n.Item = items[len(items)-1]
+	n.Pos = n.Item.Position()
+	items[len(items)-1] = n
+
+	return items
+}
+
+// Checks if token i is a rule reference
+func (p *treeParser) isReference(i int) bool {
+	if p.refs == nil {
+		return strings.HasPrefix(p.tokens[i], "<") && strings.HasSuffix(p.tokens[i], ">")
+	}
+
+	return i < len(p.refs) && p.refs[i]
+}
+
+// Parses the rule reference, weight, or text at the current token
+func (p *treeParser) leaf() Node {
+	var (
+		t   Expression = p.tokens[p.i]
+		pos Position   = p.position(p.i)
+	)
+
+	if p.isReference(p.i) {
+		return &RuleRef{Pos: pos, Name: t, token: p.i}
+	}
+	if !isWeighted(t) {
+		return p.text(t)
+	}
+	n := &Weight{Pos: pos, token: p.i}
+	exp, weight, err := ParseWeight(t)
+	if err != nil {
+		p.fail(p.i, ErrInvalidWeight.Error(), err)
+		return n
+	}
+	n.Value = weight
+	if strings.TrimSpace(exp) != "" {
+		n.Item = p.text(exp)
+	}
+
+	return n
+}
+
+// Parses text at the current token into a literal, followed by any tags in it
+func (p *treeParser) text(t Expression) Node {
+	var (
+		pos  Position = p.position(p.i)
+		tags [][]int  = regexp.MustCompile(`\{[^{}]*\}`).FindAllStringIndex(t, -1)
+		rest []string
+		prev int
+	)
+
+	for _, tag := range tags {
+		rest = append(rest, t[prev:tag[0]])
+		prev = tag[1]
+	}
+	rest = append(rest, t[prev:])
+
+	var n Node = &Literal{Pos: pos, Text: strings.TrimSpace(strings.Join(rest, "")), token: p.i}
+	if len(tags) > 0 && n.(*Literal).Text == "" {
+		n = nil
+	}
+	for _, tag := range tags {
+		n = &Tag{Pos: pos, Text: strings.TrimSpace(t[tag[0]+1 : tag[1]-1]), Item: n, token: p.i}
+	}
+
+	return n
+}
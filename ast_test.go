@@ -0,0 +1,194 @@
+// -*- coding: utf-8 -*-
+
+// Created on Sat Oct 17 04:58:09 PM EDT 2026
+// author: Ryan Hildebrandt, github.com/ryancahildebrandt
+
+package gsgf
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Helper function to write a syntax tree in a compact form, such as seq(lit(a) ref(<b>))
+func treeString(n Node) string {
+	var items []string
+
+	switch n := n.(type) {
+	case nil:
+		return "nil"
+	case *Sequence:
+		for _, item := range n.Items {
+			items = append(items, treeString(item))
+		}
+		return fmt.Sprintf("seq(%v)", strings.Join(items, " "))
+	case *Alternatives:
+		for _, item := range n.Items {
+			items = append(items, treeString(item))
+		}
+		return fmt.Sprintf("alt(%v)", strings.Join(items, " | "))
+	case *Group:
+		return fmt.Sprintf("group(%v)", treeString(n.Body))
+	case *Optional:
+		return fmt.Sprintf("opt(%v)", treeString(n.Body))
+	case *RuleRef:
+		return fmt.Sprintf("ref(%v)", n.Name)
+	case *Literal:
+		return fmt.Sprintf("lit(%v)", n.Text)
+	case *Tag:
+		return fmt.Sprintf("tag(%v, %v)", n.Text, treeString(n.Item))
+	case *Weight:
+		return fmt.Sprintf("weight(%v, %v)", n.Value, treeString(n.Item))
+	case *Repeat:
+		return fmt.Sprintf("repeat(%v, %v)", n.Min, treeString(n.Item))
+	default:
+		return "?"
+	}
+}
+
+func TestParseExpansion(t *testing.T) {
+	lexer := NewJSGFLexer("\"")
+	table := []struct {
+		e       string
+		want    string
+		wantErr bool
+	}{
+		{e: "", want: "seq()", wantErr: false},
+		{e: ";", want: "seq()", wantErr: false},
+		{e: "a <b> c;", want: "seq(lit(a) ref(<b>) lit(c))", wantErr: false},
+		{e: "a | b | c;", want: "alt(seq(lit(a)) | seq(lit(b)) | seq(lit(c)))", wantErr: false},
+		{e: "[x] (y | z)*;", want: "seq(opt(seq(lit(x))) lit() repeat(0, group(alt(seq(lit(y)) | seq(lit(z))))))", wantErr: false},
+		{e: "one two+;", want: "seq(lit(one) repeat(1, lit(two)))", wantErr: false},
+		{e: "(| a);", want: "seq(group(alt(seq() | seq(lit(a)))))", wantErr: false},
+		{e: "/10/ a | /1/ <b>;", want: "alt(weight(10, seq(lit(a))) | weight(1, seq(lit() ref(<b>))))", wantErr: false},
+		{e: "i want /2/;", want: "seq(weight(2, lit(i want)))", wantErr: false},
+		{e: "small {size} | large;", want: "alt(seq(tag(size, lit(small)) lit()) | seq(lit(large)))", wantErr: false},
+		{e: "<a> {t};", want: "seq(ref(<a>) tag(t, nil))", wantErr: false},
+		{e: "\"<b>\" c;", want: "seq(lit(<b> c))", wantErr: false},
+		{e: "say \"<b>\";", want: "seq(lit(say) lit(<b>))", wantErr: false},
+		{e: "(a;", want: "seq(group(seq(lit(a))))", wantErr: true},
+		{e: "a);", want: "seq(lit(a))", wantErr: true},
+		{e: "[a);", want: "seq(opt(seq(lit(a))))", wantErr: true},
+		{e: "* a;", want: "seq(repeat(0, nil) lit(a))", wantErr: true},
+		{e: "a |*;", want: "alt(seq(lit(a)) | seq(repeat(0, nil)))", wantErr: true},
+		{e: "/1.2.3/ a | /1/ b;", want: "alt(weight(0, seq(lit(a))) | weight(1, seq(lit(b))))", wantErr: true},
+	}
+	for i, test := range table {
+		n, err := ParseExpansion(test.e, lexer)
+		got := treeString(n)
+		if got != test.want {
+			t.Errorf("test %v: ParseExpansion(%v)\nGOT %v\nWANT %v", i, test.e, got, test.want)
+		}
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: ParseExpansion(%v).err\nGOT %v\nWANT %v", i, test.e, err, test.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidRule) && !errors.Is(err, ErrInvalidWeight) {
+			t.Errorf("test %v: errors.Is(ParseExpansion(%v).err, ErrInvalidRule)\nGOT false\nWANT true", i, test.e)
+		}
+	}
+}
+
+func TestParseExpansionErrors(t *testing.T) {
+	lexer := NewJSGFLexer("\"")
+	table := []struct {
+		e    string
+		want []string
+	}{
+		{e: "a (b | c;", want: []string{"1:3: unclosed group ("}},
+		{e: "a] b);", want: []string{"1:2: unmatched closing bracket ]", "1:5: unmatched closing bracket )"}},
+		{e: "(a] |* b;", want: []string{"1:1: unclosed group (", "1:3: unmatched closing bracket ]", "1:6: repetition operator does not follow an item *"}},
+		{e: "é /1.2.3/ | /1/ b;", want: []string{"1:1: invalid weight é /1.2.3/"}},
+	}
+	for i, test := range table {
+		var (
+			errs ErrorList
+			got  []string
+		)
+
+		_, err := ParseExpansion(test.e, lexer)
+		if !errors.As(err, &errs) {
+			t.Errorf("test %v: ParseExpansion(%v).err\nGOT %v\nWANT ErrorList", i, test.e, err)
+			continue
+		}
+		for _, e := range errs {
+			got = append(got, e.Error())
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("test %v: ParseExpansion(%v).err\nGOT %v\nWANT %v", i, test.e, got, test.want)
+		}
+	}
+}
+
+func TestParseExpansionPositions(t *testing.T) {
+	lexer := NewJSGFLexer("\"")
+	table := []struct {
+		e    string
+		want []string
+	}{
+		{e: "a <b> c;", want: []string{"1:1 seq", "1:1 a", "1:3 <b>", "1:6 c"}},
+		{e: "é [<b> | c]+;", want: []string{"1:1 seq", "1:1 é", "1:3 repeat", "1:3 opt", "1:4 alt", "1:4 seq", "1:4 <b>", "1:7 ", "1:9 seq", "1:9 c"}},
+		{e: "/2/ x | /1/ y;", want: []string{"1:1 alt", "1:1 weight", "1:4 seq", "1:4 x", "1:9 weight", "1:12 seq", "1:12 y"}},
+	}
+	for i, test := range table {
+		var got []string
+
+		n, _ := ParseExpansion(test.e, lexer)
+		Walk(n, func(n Node) bool {
+			var desc string
+			switch n := n.(type) {
+			case *Sequence:
+				desc = "seq"
+			case *Alternatives:
+				desc = "alt"
+			case *Optional:
+				desc = "opt"
+			case *Repeat:
+				desc = "repeat"
+			case *Weight:
+				desc = "weight"
+			case *RuleRef:
+				desc = n.Name
+			case *Literal:
+				desc = n.Text
+			}
+			got = append(got, fmt.Sprintf("%v %v", n.Position(), desc))
+			return true
+		})
+		if !slices.Equal(got, test.want) {
+			t.Errorf("test %v: ParseExpansion(%v) positions\nGOT %v\nWANT %v", i, test.e, got, test.want)
+		}
+	}
+}
+
+func TestWalk(t *testing.T) {
+	lexer := NewJSGFLexer("\"")
+	table := []struct {
+		e    string
+		skip bool
+		want []string
+	}{
+		{e: "a <b> [<c> | (<d>)*] <b>;", skip: false, want: []string{"<b>", "<c>", "<d>", "<b>"}},
+		{e: "a <b> [<c> | (<d>)*] <b>;", skip: true, want: []string{"<b>", "<b>"}},
+		{e: "/2/ <x> | /1/ {t};", skip: false, want: []string{"<x>"}},
+		{e: "", skip: false, want: []string{}},
+	}
+	for i, test := range table {
+		var got []string
+
+		n, _ := ParseExpansion(test.e, lexer)
+		Walk(n, func(n Node) bool {
+			ref, ok := n.(*RuleRef)
+			if ok {
+				got = append(got, ref.Name)
+			}
+			_, opt := n.(*Optional)
+			return !(test.skip && opt)
+		})
+		if !slices.Equal(got, test.want) && len(got)+len(test.want) > 0 {
+			t.Errorf("test %v: Walk(%v)\nGOT %v\nWANT %v", i, test.e, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,438 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"maps"
+	"math/big"
+	mrand "math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ryancahildebrandt/gsgf"
+	"github.com/urfave/cli/v3"
+)
+
+var (
+	inFile       cli.StringFlag = cli.StringFlag{Name: "inFile", Hidden: true}
+	ext          cli.StringFlag = cli.StringFlag{Name: "ext", Hidden: true}
+	quoteChar    cli.StringFlag = cli.StringFlag{Name: "quoteChar", Value: "\"", Hidden: true}
+	nProductions cli.IntFlag    = cli.IntFlag{
+		Name:        "nProductions",
+		Aliases:     []string{"n"},
+		Value:       -1,
+		HideDefault: true,
+		Usage:       "Number of productions to take from the top of the productions list",
+	}
+	offset cli.StringFlag = cli.StringFlag{
+		Name:  "offset",
+		Value: "0",
+		Usage: "Index of the first production to generate, skipping the productions before it without generating them. Productions are indexed in the order they are generated without --shuffle",
+	}
+	maxRepeat cli.IntFlag = cli.IntFlag{
+		Name:  "maxRepeat",
+		Value: 3,
+		Usage: "Maximum number of times a token or group followed by * or + is repeated in a production, each time the production reaches it. Must be at least 1",
+	}
+	maxDepth cli.IntFlag = cli.IntFlag{
+		Name:  "maxDepth",
+		Value: 0,
+		Usage: "Maximum number of levels recursive rule references are expanded to before being treated as <VOID>. If 0, recursive rules raise an error",
+	}
+	minimize cli.BoolFlag = cli.BoolFlag{
+		Name:    "minimize",
+		Aliases: []string{"m"},
+		Usage:   "Minimze graph before calculating paths and productions. May boost performance on graphs with many flow control tokens ()[]|",
+	}
+	shuffle cli.BoolFlag = cli.BoolFlag{
+		Name:    "shuffle",
+		Aliases: []string{"s"},
+		Usage:   "Shuffle production order before returning",
+	}
+	strictVisibility cli.BoolFlag = cli.BoolFlag{
+		Name:  "strictVisibility",
+		Usage: "Only allow public rules of imported grammars to be referenced from outside of their own grammar",
+	}
+	strictDuplicates cli.BoolFlag = cli.BoolFlag{
+		Name:  "strictDuplicates",
+		Usage: "Report local rules that shadow imported rules of the same name as errors rather than warnings",
+	}
+	grammarPath cli.StringFlag = cli.StringFlag{
+		Name:    "grammarPath",
+		Usage:   "List of directories searched in order for imported grammars, separated by : (; on Windows). If empty, subdirectories of the input grammar's directory are searched",
+		Sources: cli.EnvVars("GSGF_PATH"),
+	}
+	singleQuote cli.BoolFlag = cli.BoolFlag{
+		Name:  "singleQuote",
+		Usage: "Changes lexer's default quote character from double quotes to single",
+	}
+	removeTags cli.BoolFlag = cli.BoolFlag{
+		Name:  "removeTags",
+		Usage: "Remove all tags from productions",
+	}
+	renderNewlines cli.BoolFlag = cli.BoolFlag{
+		Name:  "renderNewlines",
+		Usage: "Replace \\n with new line in productions",
+	}
+	renderTabs cli.BoolFlag = cli.BoolFlag{
+		Name:  "renderTabs",
+		Usage: "Replace \\t with tab character in productions",
+	}
+	removeMultiSpaces cli.BoolFlag = cli.BoolFlag{
+		Name:  "removeMultiSpaces",
+		Usage: "Replace multiple consecutive spaces with single space in productions",
+	}
+	removeEndSpaces cli.BoolFlag = cli.BoolFlag{
+		Name:  "removeEndSpaces",
+		Usage: "Removing trailing and leading spaces in productions",
+	}
+	encodeOutput cli.BoolFlag = cli.BoolFlag{
+		Name:  "encodeOutput",
+		Usage: "Encode productions in the charset declared in the grammar's #JSGF header instead of UTF-8",
+	}
+	outFile cli.StringFlag = cli.StringFlag{
+		Name:    "outFile",
+		Aliases: []string{"o"},
+		Usage:   "Text file to write productions to. If blank, productions are returned to stdout",
+	}
+	exportDir cli.StringFlag = cli.StringFlag{
+		Name:    "exportDir",
+		Aliases: []string{"e"},
+		Value:   "./export",
+		Usage:   "Directory to write export results to",
+	}
+	referencedRules cli.BoolFlag = cli.BoolFlag{
+		Name:  "referencedRules",
+		Usage: "Also report the number of productions of each rule referenced by a public rule",
+	}
+	wrapProductionsPrefix cli.StringFlag = cli.StringFlag{
+		Name:  "wrapProductionsPrefix",
+		Usage: "Prefix applied to all productions",
+	}
+	wrapProductionsSuffix cli.StringFlag = cli.StringFlag{
+		Name:  "wrapProductionsSuffix",
+		Usage: "Suffix applied to all productions",
+	}
+	collectTagsChar cli.StringFlag = cli.StringFlag{
+		Name:  "collectTagsChar",
+		Usage: "Comment character to place between production and collected tags. If empty, tags are moved to the end of the production line",
+	}
+	wrapTagsPrefix cli.StringFlag = cli.StringFlag{
+		Name:  "wrapTagsPrefix",
+		Usage: "Prefix applied to all tags",
+	}
+	wrapTagsSuffix cli.StringFlag = cli.StringFlag{
+		Name:  "wrapTagsSuffix",
+		Usage: "Suffix applied to all tags",
+	}
+)
+
+// Exit codes of the gsgf executable, by the kind of error that stopped it
+const (
+	exitError   = 1
+	exitUsage   = 2
+	exitSyntax  = 3
+	exitImport  = 4
+	exitResolve = 5
+)
+
+// Returned when an input file, output file, or export directory passed to the cli is not usable
+var errInvalidArgument = errors.New("invalid argument")
+
+// Returns the exit code for an error returned by a gsgf command
+// If err reports several problems in a grammar, syntax errors take precedence over import and resolution errors
+func exitCode(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, errInvalidArgument), errors.Is(err, gsgf.ErrInvalidOption):
+		return exitUsage
+	case errors.Is(err, gsgf.ErrInvalidHeader), errors.Is(err, gsgf.ErrInvalidName), errors.Is(err, gsgf.ErrInvalidImport), errors.Is(err, gsgf.ErrInvalidRule), errors.Is(err, gsgf.ErrInvalidStatement),
+		errors.Is(err, gsgf.ErrInvalidWeight), errors.Is(err, gsgf.ErrDuplicateRule), errors.Is(err, gsgf.ErrUnclosedComment), errors.Is(err, gsgf.ErrInvalidJJSGF),
+		errors.Is(err, gsgf.ErrUnsupportedFormat), errors.Is(err, gsgf.ErrUnsupportedCharset):
+		return exitSyntax
+	case errors.Is(err, gsgf.ErrGrammarNotFound), errors.Is(err, gsgf.ErrPrivateRule):
+		return exitImport
+	case errors.Is(err, gsgf.ErrUndefinedRule), errors.Is(err, gsgf.ErrAmbiguousReference), errors.Is(err, gsgf.ErrCyclicReference):
+		return exitResolve
+	default:
+		return exitError
+	}
+}
+
+// Checks that the provided path exists on disk and has extension .jsgf/.jjsgf
+func ValidateInFile(p string) error {
+	_, err := os.Open(p)
+	if err != nil {
+		return fmt.Errorf("in ValidateInFile(%v):\n%+w", p, fmt.Errorf("%w, %w", errInvalidArgument, err))
+	}
+	switch filepath.Ext(p) {
+	case ".jsgf", ".jjsgf":
+		return nil
+	default:
+		return fmt.Errorf("in ValidateInFile(%v):\n%+w", p, fmt.Errorf("%w, file extension is not one of .jsgf, .jjsgf", errInvalidArgument))
+	}
+}
+
+// Checks that the directory (if present) in the provided path exists
+func ValidateOutFile(p string) error {
+	_, err := os.Stat(filepath.Dir(p))
+	if err != nil {
+		return fmt.Errorf("in ValidateOutFile(%v):\n%+w", p, fmt.Errorf("%w, %w", errInvalidArgument, err))
+	}
+	return nil
+}
+
+// Checks that the provided path points to a directory that exists on disk
+func ValidateExportDir(p string) error {
+	info, err := os.Stat(p)
+	if err != nil {
+		return fmt.Errorf("in ValidateExportDir(%v):\n%+w", p, fmt.Errorf("%w, %w", errInvalidArgument, err))
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("in ValidateExportDir(%v):\n%+w", p, fmt.Errorf("%w, provided path is not a directory", errInvalidArgument))
+	}
+	return nil
+}
+
+// Checks that the value of --maxRepeat allows each loop to be taken at least once
+func ValidateMaxRepeat(n int64) error {
+	if n < 1 {
+		return fmt.Errorf("in ValidateMaxRepeat(%v):\n%+w", n, fmt.Errorf("%w, maxRepeat must be at least 1", errInvalidArgument))
+	}
+	return nil
+}
+
+// Reads a production index such as the value of --offset, which can be larger than an int64 for grammars with many productions
+func ParseOffset(s string) (*big.Int, error) {
+	i, ok := new(big.Int).SetString(s, 10)
+	if !ok || i.Sign() < 0 {
+		return new(big.Int), fmt.Errorf("in ParseOffset(%v):\n%+w", s, fmt.Errorf("%w, offset is not a non-negative integer", errInvalidArgument))
+	}
+
+	return i, nil
+}
+
+// Applies post processing options to productions based on flags in cli
+func applyPostproc(p []string, cmd *cli.Command) []string {
+	if cmd.Bool("shuffle") {
+		mrand.Shuffle(len(p), func(i, j int) { p[i], p[j] = p[j], p[i] })
+	}
+	if cmd.String("wrapProductionsPrefix") != "" || cmd.String("wrapProductionsSuffix") != "" {
+		p = gsgf.WrapProductions(p, cmd.String("wrapProductionsPrefix"), cmd.String("wrapProductionsSuffix"))
+	}
+	if cmd.String("wrapTagsPrefix") != "" || cmd.String("wrapTagsSuffix") != "" {
+		p = gsgf.WrapProductions(p, cmd.String("wrapTagsPrefix"), cmd.String("wrapTagsSuffix"))
+	}
+	if cmd.String("collectTagsChar") != "" {
+		p = gsgf.CollectTags(p, cmd.String("collectTagsChar"))
+	}
+	if cmd.Bool("removeTags") {
+		p = gsgf.RemoveTags(p)
+	}
+	if cmd.Bool("removeMultiSpaces") {
+		p = gsgf.RemoveMultipleSpaces(p)
+	}
+	if cmd.Bool("removeEndSpaces") {
+		p = gsgf.RemoveEndSpaces(p)
+	}
+	if cmd.Bool("renderNewlines") {
+		p = gsgf.RenderNewLines(p)
+	}
+	if cmd.Bool("renderTabs") {
+		p = gsgf.RenderTabs(p)
+	}
+	return p
+}
+
+// Applies post processing and encoding options to productions based on flags in cli, one production at a time as they are generated
+// With --shuffle, every production is collected and shuffled before the first one is returned
+func processProductions(p iter.Seq[string], c string, cmd *cli.Command) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		process := func(prods []string) bool {
+			var err error
+
+			prods = applyPostproc(prods, cmd)
+			if cmd.Bool("encodeOutput") {
+				prods, err = gsgf.EncodeProductions(prods, c)
+				if err != nil {
+					yield("", err)
+
+					return false
+				}
+			}
+			for _, prod := range prods {
+				if !yield(prod, nil) {
+					return false
+				}
+			}
+
+			return true
+		}
+
+		if cmd.Bool("shuffle") {
+			process(slices.Collect(p))
+
+			return
+		}
+		for prod := range p {
+			if !process([]string{prod}) {
+				return
+			}
+		}
+	}
+}
+
+// Writes productions to w separated by new lines, stopping after n productions if n != -1
+// Returns the number of productions written, or the first error returned by p or w
+func writeProductions(w io.Writer, p iter.Seq2[string, error], n int) (int, error) {
+	var count int
+
+	if n == 0 {
+		return count, nil
+	}
+	for prod, err := range p {
+		if err != nil {
+			return count, err
+		}
+		if count > 0 {
+			prod = "\n" + prod
+		}
+		_, err = io.WriteString(w, prod)
+		if err != nil {
+			return count, err
+		}
+		count++
+		if count == n {
+			break
+		}
+	}
+
+	return count, nil
+}
+
+// Helper function to write productions to --outFile, or to stdout with one production per line if not set
+// Productions are written as they are generated, and generation stops once --nProductions have been written
+func outputProductions(p iter.Seq2[string, error], cmd *cli.Command) error {
+	var (
+		out *os.File = os.Stdout
+		err error
+	)
+
+	if cmd.String("outFile") != "" {
+		out, err = os.Create(cmd.String("outFile"))
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+	w := bufio.NewWriter(out)
+	count, err := writeProductions(w, p, int(cmd.Int("nProductions")))
+	if err == nil && count > 0 && out == os.Stdout {
+		_, err = w.WriteString("\n")
+	}
+
+	return cmp.Or(err, w.Flush())
+}
+
+// Writes the number of productions of each public rule of g to w, followed by the total for the grammar, as tab separated lines of kind, rule, and count
+// If r is set, the number of productions of each rule referenced by a public rule is written before the total
+func writeCounts(w io.Writer, g gsgf.Grammar, r bool, o gsgf.Options) error {
+	var (
+		counts     map[string]*big.Int = gsgf.CountRuleProductions(g, o)
+		public     []string
+		referenced []string
+		lines      []string
+	)
+
+	for _, k := range slices.Sorted(maps.Keys(counts)) {
+		if g.Rules[k].IsPublic {
+			public = append(public, k)
+		} else {
+			referenced = append(referenced, k)
+		}
+	}
+	for _, k := range public {
+		lines = append(lines, fmt.Sprintf("public\t%v\t%v", k, counts[k]))
+	}
+	if r {
+		for _, k := range referenced {
+			lines = append(lines, fmt.Sprintf("referenced\t%v\t%v", k, counts[k]))
+		}
+	}
+	lines = append(lines, fmt.Sprintf("total\t%v\t%v", g.Name, gsgf.CountProductions(g, o)))
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+
+	return err
+}
+
+// Helper function to collect grammar options from flags in cli
+func getOptions(cmd *cli.Command) gsgf.Options {
+	return gsgf.Options{
+		QuoteChar:        cmd.String("quoteChar"),
+		MaxRepeat:        int(cmd.Int("maxRepeat")),
+		MaxDepth:         int(cmd.Int("maxDepth")),
+		Minimize:         cmd.Bool("minimize"),
+		StrictVisibility: cmd.Bool("strictVisibility"),
+		StrictDuplicates: cmd.Bool("strictDuplicates"),
+		GrammarPath:      filepath.SplitList(cmd.String("grammarPath")),
+	}
+}
+
+// Helper function to construct, resolve, and minimize grammar/namespaces in cli
+// Errors at a position in a grammar file are returned on their own, as file:line:col: message text
+// Warnings are written to stderr without stopping the command
+func buildGrammar(cmd *cli.Command) (gsgf.Grammar, error) {
+	g, err := gsgf.LoadFile(cmd.String("inFile"), getOptions(cmd))
+	if err != nil {
+		return g, sourceError(err)
+	}
+	for _, w := range g.Warnings {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+	g, err = gsgf.Resolve(g, getOptions(cmd))
+	if err != nil {
+		return g, sourceError(err)
+	}
+
+	return g, nil
+}
+
+// Returns the gsgf.ErrorList or first gsgf.SourceError wrapped in err, or err itself if there is neither
+func sourceError(err error) error {
+	var (
+		errs gsgf.ErrorList
+		se   *gsgf.SourceError
+	)
+
+	switch {
+	case errors.As(err, &errs):
+		return errs
+	case errors.As(err, &se):
+		return se
+	default:
+		return err
+	}
+}
+
+// Sets additional cli args before each gsgf command is run
+func prepareContext(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+	if cmd.Args().Get(0) == "" {
+		cli.ShowSubcommandHelpAndExit(cmd, 0)
+	}
+
+	cmd.Set("inFile", cmd.Args().Get(0))
+	cmd.Set("ext", filepath.Ext(cmd.Args().Get(0)))
+	if cmd.Bool("singleQuote") {
+		cmd.Set("quoteChar", "'")
+	}
+
+	return ctx, nil
+}
@@ -0,0 +1,290 @@
+// -*- coding: utf-8 -*-
+
+// Created on Sun Mar 16 05:13:48 PM EDT 2025
+// author: Ryan Hildebrandt, github.com/ryancahildebrandt
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ryancahildebrandt/gsgf"
+)
+
+func TestValidateExportDir(t *testing.T) {
+	table := []struct {
+		p       string
+		wantErr bool
+	}{
+		{p: "", wantErr: true},
+		{p: ".", wantErr: false},
+		{p: " ", wantErr: true},
+		{p: ".txt/", wantErr: true},
+		{p: "../a", wantErr: true},
+		{p: "out/a", wantErr: true},
+		{p: "../../export/out.txt", wantErr: true},
+		{p: "data/data/b", wantErr: true},
+		{p: "../../data/tests/dir0/", wantErr: false},
+	}
+	for i, test := range table {
+		err := ValidateExportDir(test.p)
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: ValidateExportDir(%v)\nGOT %v\nWANT %v", i, test.p, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidateOutFile(t *testing.T) {
+	table := []struct {
+		p       string
+		wantErr bool
+	}{
+		{p: "", wantErr: false},
+		{p: ".", wantErr: false},
+		{p: " ", wantErr: false},
+		{p: ".txt", wantErr: false},
+		{p: "../a.txt", wantErr: false},
+		{p: "out/a", wantErr: true},
+		{p: "../../export/out.txt", wantErr: false},
+		{p: "data/data/b", wantErr: true},
+		{p: "../../data/tests/dir0/", wantErr: false},
+	}
+	for i, test := range table {
+		err := ValidateOutFile(test.p)
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: ValidateOutFile(%v)\nGOT %v\nWANT %v", i, test.p, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidateInFile(t *testing.T) {
+	table := []struct {
+		p       string
+		wantErr bool
+	}{
+		{p: "", wantErr: true},
+		{p: ".", wantErr: true},
+		{p: " ", wantErr: true},
+		{p: ".jsgf", wantErr: true},
+		{p: "../a.jsgf", wantErr: true},
+		{p: "../../data/tests/a.jsgf", wantErr: false},
+		{p: "../../data/tests/dir0/c.jsgf", wantErr: false},
+		{p: "../../data/tests/test0.jsgf", wantErr: false},
+	}
+	for i, test := range table {
+		err := ValidateInFile(test.p)
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: ValidateInFile(%v)\nGOT %v\nWANT %v", i, test.p, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidateMaxRepeat(t *testing.T) {
+	table := []struct {
+		n       int64
+		wantErr bool
+	}{
+		{n: -1, wantErr: true},
+		{n: 0, wantErr: true},
+		{n: 1, wantErr: false},
+		{n: 3, wantErr: false},
+	}
+	for i, test := range table {
+		err := ValidateMaxRepeat(test.n)
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: ValidateMaxRepeat(%v)\nGOT %v\nWANT %v", i, test.n, err, test.wantErr)
+		}
+	}
+}
+
+func TestParseOffset(t *testing.T) {
+	table := []struct {
+		s       string
+		want    string
+		wantErr bool
+	}{
+		{s: "0", want: "0", wantErr: false},
+		{s: "48213", want: "48213", wantErr: false},
+		{s: "100000000000000000000000000000", want: "100000000000000000000000000000", wantErr: false},
+		{s: "-1", want: "0", wantErr: true},
+		{s: "", want: "0", wantErr: true},
+		{s: "1e3", want: "0", wantErr: true},
+	}
+	for i, test := range table {
+		got, err := ParseOffset(test.s)
+		if got.String() != test.want {
+			t.Errorf("test %v: ParseOffset(%v)\nGOT %v\nWANT %v", i, test.s, got, test.want)
+		}
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: ParseOffset(%v).err\nGOT %v\nWANT %v", i, test.s, err, test.wantErr)
+		}
+		if err != nil && exitCode(err) != exitUsage {
+			t.Errorf("test %v: exitCode(ParseOffset(%v).err)\nGOT %v\nWANT %v", i, test.s, exitCode(err), exitUsage)
+		}
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	table := []struct {
+		err  error
+		want int
+	}{
+		{err: nil, want: 0},
+		{err: errors.New("a"), want: exitError},
+		{err: ValidateInFile("../a.jsgf"), want: exitUsage},
+		{err: ValidateInFile("../../README.md"), want: exitUsage},
+		{err: ValidateExportDir("../../README.md"), want: exitUsage},
+		{err: loadError("grammar a;\n<a> = b"), want: exitSyntax},
+		{err: loadError("#JSGF 1.0;"), want: exitSyntax},
+		{err: loadError("grammar a;\npublic <a> = /1/ b | c;"), want: exitSyntax},
+		{err: loadError("grammar a;\npublic <a> = <b>;"), want: exitResolve},
+		{err: loadError("grammar a;\npublic <a> = <b>;\n<b> = <a>;"), want: exitResolve},
+		{err: loadError("grammar a;\npublic <a> = b;\n<a> = c;"), want: exitSyntax},
+		{err: loadError("grammar a;\npublic <a> = b;\nthis is junk;"), want: exitSyntax},
+		{err: gsgf.ErrorList{{Err: gsgf.ErrUndefinedRule}, {Err: gsgf.ErrInvalidRule}}, want: exitSyntax},
+		{err: fmt.Errorf("in f():\n%+w", gsgf.ErrGrammarNotFound), want: exitImport},
+		{err: &gsgf.SourceError{Err: gsgf.ErrPrivateRule}, want: exitImport},
+		{err: fmt.Errorf("in f():\n%+w", gsgf.ErrNoPublicRules), want: exitError},
+		{err: ValidateMaxRepeat(0), want: exitUsage},
+		{err: fmt.Errorf("in f():\n%+w", gsgf.ErrInvalidOption), want: exitUsage},
+	}
+	for i, test := range table {
+		got := exitCode(test.err)
+		if got != test.want {
+			t.Errorf("test %v: exitCode(%v)\nGOT %v\nWANT %v", i, test.err, got, test.want)
+		}
+	}
+}
+
+func TestMainErrors(t *testing.T) {
+	if os.Getenv("GSGF_TEST_MAIN") != "" {
+		os.Args = append([]string{"gsgf"}, strings.Split(os.Getenv("GSGF_TEST_MAIN"), " ")...)
+		main()
+		return
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"c.jsgf":     "grammar c;\nimport <d.*>;\npublic <main> = <drink>;",
+		"lib/d.jsgf": "grammar d;\nimport <e.*>;\npublic <drink> = <size> tea;",
+	}
+	for k, v := range files {
+		os.MkdirAll(filepath.Join(dir, filepath.Dir(k)), 0o755)
+		os.WriteFile(filepath.Join(dir, k), []byte(v), 0o644)
+	}
+	table := []struct {
+		args string
+		code int
+		want string
+	}{
+		{args: "generate " + filepath.Join(dir, "c.jsgf"), code: exitImport, want: "d.jsgf:2:9: grammar not found e, import chain c -> d -> e"},
+	}
+	for i, test := range table {
+		var stderr strings.Builder
+
+		cmd := exec.Command(os.Args[0], "-test.run=^TestMainErrors$")
+		cmd.Env = append(os.Environ(), "GSGF_TEST_MAIN="+test.args)
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		var exit *exec.ExitError
+		if !errors.As(err, &exit) || exit.ExitCode() != test.code {
+			t.Errorf("test %v: gsgf %v exit code\nGOT %v\nWANT %v", i, test.args, err, test.code)
+		}
+		if !strings.Contains(stderr.String(), test.want) {
+			t.Errorf("test %v: gsgf %v stderr\nGOT %q\nWANT %q", i, test.args, stderr.String(), test.want)
+		}
+	}
+}
+
+func TestWriteProductions(t *testing.T) {
+	table := []struct {
+		p         []string
+		err       error
+		n         int
+		want      string
+		wantCount int
+	}{
+		{p: []string{"a", "b", "c"}, err: nil, n: -1, want: "a\nb\nc", wantCount: 3},
+		{p: []string{"a", "b", "c"}, err: nil, n: 2, want: "a\nb", wantCount: 2},
+		{p: []string{"a", "b", "c"}, err: nil, n: 0, want: "", wantCount: 0},
+		{p: []string{"a", "b", "c"}, err: nil, n: 5, want: "a\nb\nc", wantCount: 3},
+		{p: []string{}, err: nil, n: -1, want: "", wantCount: 0},
+		{p: []string{"a", "b", "c"}, err: errors.New("b"), n: -1, want: "a", wantCount: 1},
+	}
+	for i, test := range table {
+		var (
+			w      strings.Builder
+			yields int
+		)
+
+		p := func(yield func(string, error) bool) {
+			for _, prod := range test.p {
+				yields++
+				var err error
+				if prod == "b" {
+					err = test.err
+				}
+				if !yield(prod, err) {
+					return
+				}
+			}
+		}
+		count, err := writeProductions(&w, p, test.n)
+		if w.String() != test.want || count != test.wantCount {
+			t.Errorf("test %v: writeProductions(%v, %v)\nGOT %q, %v\nWANT %q, %v", i, test.p, test.n, w.String(), count, test.want, test.wantCount)
+		}
+		if (err != nil) != (test.err != nil) {
+			t.Errorf("test %v: writeProductions(%v, %v).err\nGOT %v\nWANT %v", i, test.p, test.n, err, test.err)
+		}
+		if test.n >= 0 && yields > test.n {
+			t.Errorf("test %v: writeProductions(%v, %v) productions generated\nGOT %v\nWANT <= %v", i, test.p, test.n, yields, test.n)
+		}
+	}
+}
+
+func TestWriteCounts(t *testing.T) {
+	table := []struct {
+		s    string
+		r    bool
+		want string
+	}{
+		{s: "grammar a;\npublic <a> = <b> <b>;\n<b> = x | y | z;", r: false, want: "public\t<a>\t9\ntotal\ta\t9\n"},
+		{s: "grammar a;\npublic <a> = <b> <b>;\n<b> = x | y | z;", r: true, want: "public\t<a>\t9\nreferenced\t<b>\t3\ntotal\ta\t9\n"},
+		{s: "grammar a;\npublic <a> = x [y];\npublic <b> = <a> | z;\n<c> = w;", r: true, want: "public\t<a>\t2\npublic\t<b>\t3\ntotal\ta\t5\n"},
+		{s: "grammar a;\n<a> = x;", r: true, want: "total\ta\t0\n"},
+	}
+	for i, test := range table {
+		var w strings.Builder
+
+		o := gsgf.NewOptions()
+		g, err := gsgf.LoadString(test.s, o)
+		if err == nil {
+			g, err = gsgf.Resolve(g, o)
+		}
+		if err != nil {
+			t.Errorf("test %v: LoadString(%v).err\nGOT %v\nWANT nil", i, test.s, err)
+			continue
+		}
+		err = writeCounts(&w, g, test.r, o)
+		if w.String() != test.want || err != nil {
+			t.Errorf("test %v: writeCounts(%v, %v)\nGOT %q, %v\nWANT %q", i, test.s, test.r, w.String(), err, test.want)
+		}
+	}
+}
+
+// Helper function to get the error from loading and resolving a grammar string
+func loadError(s string) error {
+	o := gsgf.NewOptions()
+	g, err := gsgf.LoadString(s, o)
+	if err != nil {
+		return err
+	}
+	_, err = gsgf.Resolve(g, o)
+
+	return err
+}
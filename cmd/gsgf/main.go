@@ -7,13 +7,13 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
-	mrand "math/rand/v2"
+	"iter"
+	"math/big"
 	"os"
-	"strings"
+	"slices"
 
+	"github.com/ryancahildebrandt/gsgf"
 	"github.com/urfave/cli/v3"
 )
 
@@ -30,10 +30,24 @@ Options:
 	--nProductions, -n (int)
 		Number of productions to take from the top of the productions list
 
+	--offset (string) (default: 0)
+		Index of the first production to generate, skipping the productions before it without generating them.
+		Productions are indexed in the order they are generated without --shuffle
+
 	--outFile, -o (string)
 		Text file to write productions to.
 		If blank, productions are returned to stdout
 
+	--encodeOutput (bool)
+		Encode productions in the charset declared in the grammar's #JSGF header instead of UTF-8
+
+	--maxRepeat (int) (default: 3)
+		Maximum number of times a token or group followed by * or + is repeated in a production, each time the production reaches it. Must be at least 1
+
+	--maxDepth (int) (default: 0)
+		Maximum number of levels recursive rule references are expanded to before being treated as <VOID>.
+		If 0, recursive rules raise an error
+
 	--minimize, -m (bool)
 		Minimze graph before calculating paths and productions.
 		May boost performance on graphs with many flow control tokens ()[]|
@@ -44,6 +58,16 @@ Options:
 	--singleQuote (bool)
 		Changes lexer's default quote character from double quotes to single
 
+	--strictVisibility (bool)
+		Only allow public rules of imported grammars to be referenced from outside of their own grammar
+
+	--strictDuplicates (bool)
+		Report local rules that shadow imported rules of the same name as errors rather than warnings
+
+	--grammarPath (string) (env: GSGF_PATH)
+		List of directories searched in order for imported grammars, separated by : (; on Windows).
+		If empty, subdirectories of the input grammar's directory are searched
+
 	--wrapProductionsPrefix (string)
 		Prefix applied to all productions
 
@@ -78,11 +102,22 @@ Options:
 	--exportDir, -e (string) (default: "./export")
 		Directory to write export results to
 
+	--referencedRules (bool)
+		Also report the number of productions of each rule referenced by a public rule
+
 	--help, -h
 		Show help
+
+Exit codes:
+
+	0	Success
+	1	Any other error, such as failing to write productions or export results
+	2	Invalid input file, output file, or arguments
+	3	Invalid grammar syntax, such as malformed statements, weights, duplicate rules (across files with --strictDuplicates), or unclosed comments
+	4	Imported grammar not found, or private rule referenced with --strictVisibility
+	5	Undefined, ambiguous, or cyclic rule references
 */
 func main() {
-	log.SetFlags(log.LstdFlags | log.Lshortfile)
 	app := &cli.Command{
 		Name:                  "GSGF",
 		Usage:                 "Generate natural language expressions from context free grammars",
@@ -102,10 +137,17 @@ func main() {
 					&ext,
 					&quoteChar,
 					&nProductions,
+					&offset,
 					&outFile,
+					&encodeOutput,
+					&maxRepeat,
+					&maxDepth,
 					&minimize,
 					&shuffle,
 					&singleQuote,
+					&strictVisibility,
+					&strictDuplicates,
+					&grammarPath,
 					&wrapProductionsPrefix,
 					&wrapProductionsSuffix,
 					&collectTagsChar,
@@ -119,42 +161,37 @@ func main() {
 				},
 				Action: func(ctx context.Context, cmd *cli.Command) error {
 					var (
-						grammar     Grammar
-						productions []string
+						grammar     gsgf.Grammar
+						productions iter.Seq[string]
+						start       *big.Int
 						err         error
 					)
 
 					err = ValidateInFile(cmd.String("inFile"))
 					if err != nil {
-						log.Fatal(err)
+						return err
+					}
+					err = ValidateMaxRepeat(cmd.Int("maxRepeat"))
+					if err != nil {
+						return err
 					}
 					err = ValidateOutFile(cmd.String("outFile"))
 					if err != nil {
-						log.Fatal(err)
+						return err
 					}
 
-					grammar, err = buildGrammar(cmd)
+					start, err = ParseOffset(cmd.String("offset"))
 					if err != nil {
-						log.Fatal(err)
+						return err
 					}
-					productions = GetAllProductions(grammar)
-					productions = applyPostproc(productions, cmd)
-					if cmd.Int("nProductions") != -1 {
-						productions = productions[:cmd.Int("nProductions")]
-					}
-					if cmd.String("outFile") == "" {
-						for _, prod := range productions {
-							fmt.Println(prod)
-						}
 
-						return nil
-					}
-					err = os.WriteFile(cmd.String("outFile"), []byte(strings.Join(productions, "\n")), 0644)
+					grammar, err = buildGrammar(cmd)
 					if err != nil {
-						log.Fatal(err)
+						return err
 					}
+					productions = gsgf.StreamProductionsFrom(grammar, start, getOptions(cmd))
 
-					return nil
+					return outputProductions(processProductions(productions, grammar.Charset, cmd), cmd)
 				},
 			},
 
@@ -171,9 +208,15 @@ func main() {
 					&quoteChar,
 					&nProductions,
 					&outFile,
+					&encodeOutput,
+					&maxRepeat,
+					&maxDepth,
 					&minimize,
 					&shuffle,
 					&singleQuote,
+					&strictVisibility,
+					&strictDuplicates,
+					&grammarPath,
 					&wrapProductionsPrefix,
 					&wrapProductionsSuffix,
 					&collectTagsChar,
@@ -187,19 +230,22 @@ func main() {
 				},
 				Action: func(ctx context.Context, cmd *cli.Command) error {
 					var (
-						grammar     Grammar
+						grammar     gsgf.Grammar
 						productions []string
-						keys        []string
 						err         error
 					)
 
 					err = ValidateInFile(cmd.String("inFile"))
 					if err != nil {
-						log.Fatal(err)
+						return err
+					}
+					err = ValidateMaxRepeat(cmd.Int("maxRepeat"))
+					if err != nil {
+						return err
 					}
 					err = ValidateOutFile(cmd.String("outFile"))
 					if err != nil {
-						log.Fatal(err)
+						return err
 					}
 
 					if cmd.Int("nProductions") == -1 {
@@ -207,37 +253,56 @@ func main() {
 					}
 					grammar, err = buildGrammar(cmd)
 					if err != nil {
-						log.Fatal(err)
-					}
-					for k, v := range grammar.Rules {
-						if v.IsPublic {
-							keys = append(keys, k)
-						}
+						return err
 					}
-					for len(productions) < int(cmd.Int("nProductions")) {
-						key := keys[mrand.IntN(len(keys))]
-						graph := grammar.Rules[key].Graph
-						path, err := getRandomPath(graph)
-						if err != nil {
-							log.Fatal(err)
-						}
-						prod := getSingleProduction(path, filterTokens(graph.Tokens, jsgfFilter))
-						productions = append(productions, prod)
+					productions, err = gsgf.Sample(grammar, int(cmd.Int("nProductions")), getOptions(cmd))
+					if err != nil {
+						return err
 					}
-					productions = applyPostproc(productions, cmd)
-					if cmd.String("outFile") == "" {
-						for _, prod := range productions {
-							fmt.Println(prod)
-						}
 
-						return nil
+					return outputProductions(processProductions(slices.Values(productions), grammar.Charset, cmd), cmd)
+				},
+			},
+			{
+				Name:                  "count",
+				UsageText:             "gsgf count [OPTIONS] example.jsgf",
+				Usage:                 "Count the productions of each public rule in a grammar file without generating them",
+				EnableShellCompletion: true,
+				Suggest:               true,
+				Before:                prepareContext,
+				Flags: []cli.Flag{
+					&inFile,
+					&ext,
+					&quoteChar,
+					&maxRepeat,
+					&maxDepth,
+					&minimize,
+					&singleQuote,
+					&strictVisibility,
+					&strictDuplicates,
+					&grammarPath,
+					&referencedRules,
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					var (
+						grammar gsgf.Grammar
+						err     error
+					)
+					err = ValidateInFile(cmd.String("inFile"))
+					if err != nil {
+						return err
 					}
-					err = os.WriteFile(cmd.String("outFile"), []byte(strings.Join(productions, "\n")), 0644)
+					err = ValidateMaxRepeat(cmd.Int("maxRepeat"))
 					if err != nil {
-						log.Fatal(err)
+						return err
 					}
 
-					return nil
+					grammar, err = buildGrammar(cmd)
+					if err != nil {
+						return err
+					}
+
+					return writeCounts(os.Stdout, grammar, cmd.Bool("referencedRules"), getOptions(cmd))
 				},
 			},
 			{
@@ -252,68 +317,35 @@ func main() {
 					&ext,
 					&quoteChar,
 					&exportDir,
+					&maxRepeat,
+					&maxDepth,
 					&minimize,
 					&singleQuote,
+					&strictVisibility,
+					&strictDuplicates,
+					&grammarPath,
 				},
 				Action: func(ctx context.Context, cmd *cli.Command) error {
 					var (
-						grammar Grammar
-						j       []byte
+						grammar gsgf.Grammar
 						err     error
 					)
 					err = ValidateInFile(cmd.String("inFile"))
 					if err != nil {
-						log.Fatal(err)
+						return err
 					}
-
-					grammar, err = buildGrammar(cmd)
+					err = ValidateMaxRepeat(cmd.Int("maxRepeat"))
 					if err != nil {
-						log.Fatal(err)
+						return err
 					}
-					j, err = json.Marshal(grammarToJSON(grammar))
-					if err != nil {
-						log.Fatal(err)
-					}
-					err = os.WriteFile(fmt.Sprint(cmd.String("exportDir"), "/grammar.json"), j, 0644)
-					if err != nil {
-						log.Fatal(err)
-					}
-					err = os.WriteFile(fmt.Sprint(cmd.String("exportDir"), "/references.d2"), []byte(ReferencesToD2(grammar)), 0644)
+
+					grammar, err = buildGrammar(cmd)
 					if err != nil {
-						log.Fatal(err)
+						return err
 					}
-					err = os.WriteFile(fmt.Sprint(cmd.String("exportDir"), "/references.dot"), []byte(ReferencesToDOT(grammar)), 0644)
+					err = gsgf.Export(grammar, cmd.String("exportDir"), getOptions(cmd))
 					if err != nil {
-						log.Fatal(err)
-					}
-					for k, v := range grammar.Rules {
-						if v.IsPublic {
-							j, err := json.Marshal(graphToJSON(v.Graph))
-							if err != nil {
-								log.Fatal(err)
-							}
-							err = os.WriteFile(fmt.Sprint(cmd.String("exportDir"), "/", k, "_graph.json"), j, 0644)
-							if err != nil {
-								log.Fatal(err)
-							}
-							nodes, edges := GraphToTXT(v.Graph)
-							err = os.WriteFile(fmt.Sprint(cmd.String("exportDir"), "/", k, "_edges.txt"), []byte(edges), 0644)
-							if err != nil {
-								log.Fatal(err)
-							}
-							err = os.WriteFile(fmt.Sprint(cmd.String("exportDir"), "/", k, "_nodes.txt"), []byte(nodes), 0644)
-							if err != nil {
-								log.Fatal(err)
-							}
-							err = os.WriteFile(fmt.Sprint(cmd.String("exportDir"), "/", k, "_graph.d2"), []byte(GraphToD2(v.Graph)), 0644)
-							if err != nil {
-								log.Fatal(err)
-							}
-							err = os.WriteFile(fmt.Sprint(cmd.String("exportDir"), "/", k, "_graph.dot"), []byte(GraphToDOT(v.Graph)), 0644)
-							if err != nil {
-								log.Fatal(err)
-							}
-						}
+						return err
 					}
 					return nil
 				},
@@ -323,6 +355,7 @@ func main() {
 
 	err := app.Run(context.Background(), os.Args)
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitCode(err))
 	}
 }
@@ -0,0 +1,254 @@
+// -*- coding: utf-8 -*-
+
+// Created on Sat Oct 17 05:34:52 PM EDT 2026
+// author: Ryan Hildebrandt, github.com/ryancahildebrandt
+
+package gsgf
+
+import (
+	"encoding/binary"
+	"maps"
+	"math/big"
+	"slices"
+)
+
+// Counts traversal paths between graph end points without enumerating them, matching the paths yielded by allPaths
+// Outside of repetition loops the graph is acyclic, so the number of paths from a node is the sum of the number of paths from each of its children
+// Inside of a loop, paths are counted with the number of iterations of each loop the node is part of as additional state, as each loop can be repeated at most r times each time it is entered, see graphLoops
+type pathCounter struct {
+	g     Graph
+	r     int
+	to    int
+	keep  func(int) bool
+	loops graphLoops
+	memo  map[int]*big.Int
+	walks map[string]*big.Int
+}
+
+// Returns the number of paths between the end points of g that only continue through nodes for which keep returns true, repeating loops at most r times
+func countPaths(g Graph, r int, keep func(int) bool) *big.Int {
+	from, _ := getEndPoints(g)
+	c := newPathCounter(g, r, keep)
+
+	return new(big.Int).Set(c.start(from))
+}
+
+// Returns a path counter for g, with the loops of the graph found among the nodes for which keep returns true
+func newPathCounter(g Graph, r int, keep func(int) bool) *pathCounter {
+	_, to := getEndPoints(g)
+	c := pathCounter{
+		g:     g,
+		r:     r,
+		to:    to,
+		keep:  keep,
+		loops: getLoops(g, keep),
+		memo:  make(map[int]*big.Int),
+		walks: make(map[string]*big.Int),
+	}
+
+	return &c
+}
+
+// Returns a path counter that only continues through nodes for which keep returns true, reusing the loops of c
+// keep must not return true for any node c does not continue through, so that the paths counted are a subset of the paths counted by c
+func (c *pathCounter) restrict(keep func(int) bool) *pathCounter {
+	res := *c
+	res.keep = keep
+	res.memo = make(map[int]*big.Int)
+	res.walks = make(map[string]*big.Int)
+
+	return &res
+}
+
+// Returns the number of paths from node u outside of any loop to the final node
+func (c *pathCounter) count(u int) *big.Int {
+	res, ok := c.memo[u]
+	if ok {
+		return res
+	}
+
+	res = c.children(u, nil)
+	c.memo[u] = res
+
+	return res
+}
+
+// Returns the number of paths from node v inside of a loop to the final node, given the number of iterations of each loop so far
+func (c *pathCounter) walk(v int, visits []int) *big.Int {
+	key := walkKey(v, visits)
+	res, ok := c.walks[key]
+	if ok {
+		return res
+	}
+
+	res = c.children(v, visits)
+	c.walks[key] = res
+
+	return res
+}
+
+// Returns the number of paths from node v to the final node, as the sum of the number of paths from each child that can be moved to
+func (c *pathCounter) children(v int, visits []int) *big.Int {
+	var res *big.Int = new(big.Int)
+
+	if v == c.to {
+		return res.SetInt64(1)
+	}
+	for _, n := range c.g.getFrom(v) {
+		next, ok := c.move(v, visits, n)
+		if ok {
+			res.Add(res, c.from(n, next))
+		}
+	}
+
+	return res
+}
+
+// Helper function to key the number of paths from node v by the iterations of the loops of the graph
+func walkKey(v int, visits []int) string {
+	key := binary.AppendUvarint(nil, uint64(v))
+	for _, n := range visits {
+		key = binary.AppendUvarint(key, uint64(n))
+	}
+
+	return string(key)
+}
+
+// Returns the number of paths from node n to the final node, given the iterations of the loops of the graph, which are nil outside of loops
+func (c *pathCounter) from(n int, visits []int) *big.Int {
+	if visits == nil {
+		return c.count(n)
+	}
+
+	return c.walk(n, visits)
+}
+
+// Returns the number of paths from node u to the final node, where u is the first node of the path
+func (c *pathCounter) start(u int) *big.Int {
+	visits, ok := c.enter(u)
+	if !ok {
+		return new(big.Int)
+	}
+
+	return c.from(u, visits)
+}
+
+// Returns the iterations of the loops of the graph at node u when a path starts at it, and whether u can start a path
+func (c *pathCounter) enter(u int) ([]int, bool) {
+	return c.move(-1, nil, u)
+}
+
+// Returns the iterations of the loops of the graph after moving to node n from node v, and whether the move is allowed
+// - Loops that contain both nodes keep their iterations, and loops that n is not part of are left
+// - Moving to an entry node of a loop starts another iteration of it, which is not allowed once it has been repeated r times
+func (c *pathCounter) move(v int, visits []int, n int) ([]int, bool) {
+	if !c.keep(n) {
+		return nil, false
+	}
+	if len(c.loops.in[n]) == 0 {
+		return nil, true
+	}
+
+	res := make([]int, c.loops.n)
+	for _, l := range c.loops.in[n] {
+		if c.loops.contains(l, v) {
+			res[l] = visits[l]
+		}
+	}
+	for _, l := range c.loops.entry[n] {
+		if res[l] >= c.r {
+			return nil, false
+		}
+		res[l]++
+	}
+
+	return res, true
+}
+
+// Counts the productions of a rule, which are the paths through its graph other than those that only pass through empty tokens
+type productionCounter struct {
+	all    *pathCounter
+	empty  *pathCounter
+	tokens []Expression
+	from   int
+}
+
+// Returns a production counter for r, repeating loops at most n times
+func newProductionCounter(r Rule, n int) productionCounter {
+	var (
+		tokens []Expression     = filterTokens(getTokens(r), jsgfFilter)
+		live   map[int]struct{} = getLiveNodes(r.Graph)
+		from   int
+	)
+
+	from, _ = getEndPoints(r.Graph)
+	all := newPathCounter(r.Graph, n, func(i int) bool {
+		_, ok := live[i]
+		return ok && i < len(tokens)
+	})
+	empty := all.restrict(func(i int) bool {
+		return all.keep(i) && tokens[i] == ""
+	})
+
+	return productionCounter{all: all, empty: empty, tokens: tokens, from: from}
+}
+
+// Returns the number of productions that follow from moving to node n with the given iterations of the loops of the graph
+// If empty is set, every token before n is empty, so paths that only pass through empty tokens from n on are not counted
+func (p productionCounter) completions(n int, visits []int, empty bool) *big.Int {
+	res := new(big.Int).Set(p.all.from(n, visits))
+	if empty && p.tokens[n] == "" {
+		res.Sub(res, p.empty.from(n, visits))
+	}
+
+	return res
+}
+
+// Returns the total number of productions
+func (p productionCounter) total() *big.Int {
+	if p.from >= len(p.tokens) {
+		return new(big.Int)
+	}
+	visits, ok := p.all.enter(p.from)
+	if !ok {
+		return new(big.Int)
+	}
+
+	return p.completions(p.from, visits, true)
+}
+
+// Returns the number of productions of r without generating them, repeating loops at most n times
+// Matches the productions yielded by ruleProductions, so duplicate productions reached through different paths are counted separately and empty productions are not counted
+func countProductions(r Rule, n int) *big.Int {
+	return newProductionCounter(r, n).total()
+}
+
+// Returns the number of productions of each rule in the composition order of g, which includes the public rules and every rule they reference
+// Copies of recursive rules made by unrollRecursion are not counted, as their productions are part of the rule they copy
+func countRuleProductions(g Grammar, n int) map[string]*big.Int {
+	var res map[string]*big.Int = make(map[string]*big.Int)
+
+	for _, k := range getCompositionOrder(g) {
+		_, ok := res[k]
+		_, copied := g.copies[k]
+		rule, defined := g.Rules[k]
+		if !ok && !copied && defined {
+			res[k] = countProductions(rule, n)
+		}
+	}
+
+	return res
+}
+
+// Returns the total number of productions of the public rules in g
+func countAllProductions(g Grammar, n int) *big.Int {
+	var res *big.Int = new(big.Int)
+
+	for _, k := range slices.Sorted(maps.Keys(g.Rules)) {
+		if g.Rules[k].IsPublic {
+			res.Add(res, countProductions(g.Rules[k], n))
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,181 @@
+// -*- coding: utf-8 -*-
+
+// Created on Sat Oct 17 05:34:55 PM EDT 2026
+// author: Ryan Hildebrandt, github.com/ryancahildebrandt
+
+package gsgf
+
+import (
+	"maps"
+	"math/big"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCountProductions(t *testing.T) {
+	table := []struct {
+		s        string
+		minimize bool
+	}{
+		{s: "grammar a;\npublic <a> = one;", minimize: false},
+		{s: "grammar a;\npublic <a> = (one | two) [three];\npublic <b> = x | y | ;", minimize: false},
+		{s: "grammar a;\npublic <a> = (one | two) [three];\npublic <b> = x | y | ;", minimize: true},
+		{s: "grammar a;\npublic <a> = a* b+ [c]*;", minimize: false},
+		{s: "grammar a;\npublic <a> = a* b+ [c]*;", minimize: true},
+		{s: "grammar a;\npublic <a> = (x | y (z | w)* | [v])+ end;", minimize: false},
+		{s: "grammar a;\npublic <a> = (x | y (z | w)* | [v])+ end;", minimize: true},
+		{s: "grammar a;\npublic <a> = <b>* and <b>;\n<b> = one | two | <NULL>;", minimize: false},
+		{s: "grammar a;\npublic <a> = <b> | <VOID> c | [d <VOID>];\n<b> = /1/ one {tag} | /2/ two;", minimize: false},
+		{s: "grammar a;\npublic <a> = [<NULL>] [<NULL>];\npublic <b> = [x];", minimize: false},
+		{s: "grammar a;\npublic <list> = <item> [and <list>];\n<item> = tea | coffee;", minimize: false},
+		{s: "grammar a;\npublic <a> = ((a)+ b)+;", minimize: false},
+		{s: "grammar a;\npublic <a> = ((a)+ b)+;", minimize: true},
+		{s: "grammar a;\npublic <a> = (x (y | z)* w)+ [v]*;", minimize: false},
+	}
+	for i, test := range table {
+		for r := 1; r <= 3; r++ {
+			o := NewOptions()
+			o.MaxRepeat = r
+			o.MaxDepth = 2
+			o.Minimize = test.minimize
+			g, err := LoadString(test.s, o)
+			if err != nil {
+				t.Errorf("test %v: LoadString(%v).err\nGOT %v\nWANT nil", i, test.s, err)
+				break
+			}
+			g, err = Resolve(g, o)
+			if err != nil {
+				t.Errorf("test %v: Resolve(%v).err\nGOT %v\nWANT nil", i, test.s, err)
+				break
+			}
+			got := CountProductions(g, o)
+			want := big.NewInt(int64(len(Productions(g, o))))
+			if got.Cmp(want) != 0 {
+				t.Errorf("test %v: CountProductions(%v), MaxRepeat %v\nGOT %v\nWANT %v", i, test.s, r, got, want)
+			}
+			for k, v := range CountRuleProductions(g, o) {
+				want := big.NewInt(int64(len(getProductions(g.Rules[k], r))))
+				if v.Cmp(want) != 0 {
+					t.Errorf("test %v: CountRuleProductions(%v)[%v], MaxRepeat %v\nGOT %v\nWANT %v", i, test.s, k, r, v, want)
+				}
+			}
+		}
+	}
+}
+
+func TestCountProductionsFiles(t *testing.T) {
+	table := []struct {
+		p        string
+		minimize bool
+		r        int
+	}{
+		{p: "data/tests/test0.jsgf", minimize: false, r: 1},
+		{p: "data/tests/test0.jsgf", minimize: true, r: 1},
+		{p: "data/tests/test7.jsgf", minimize: false, r: 3},
+		{p: "data/tests/test0.jjsgf", minimize: false, r: 2},
+		{p: "data/tests/packages/app.jsgf", minimize: true, r: 1},
+	}
+	for i, test := range table {
+		o := NewOptions()
+		o.MaxRepeat = test.r
+		o.Minimize = test.minimize
+		g, err := LoadFile(test.p, o)
+		if err != nil {
+			t.Errorf("test %v: LoadFile(%v).err\nGOT %v\nWANT nil", i, test.p, err)
+			continue
+		}
+		g, err = Resolve(g, o)
+		if err != nil {
+			t.Errorf("test %v: Resolve(%v).err\nGOT %v\nWANT nil", i, test.p, err)
+			continue
+		}
+		got := CountProductions(g, o)
+		want := big.NewInt(int64(len(Productions(g, o))))
+		if got.Cmp(want) != 0 {
+			t.Errorf("test %v: CountProductions(%v)\nGOT %v\nWANT %v", i, test.p, got, want)
+		}
+	}
+}
+
+func TestCountProductionsQuote(t *testing.T) {
+	table := []struct {
+		p    string
+		q    string
+		want string
+	}{
+		{p: "data/tea.jsgf", q: "\"", want: "630"},
+		{p: "data/tea.jsgf", q: "'", want: "630"},
+		{p: "data/tea.jsgf", q: "", want: "630"},
+	}
+	for i, test := range table {
+		o := NewOptions()
+		o.QuoteChar = test.q
+		g, err := LoadFile(test.p, o)
+		if err == nil {
+			g, err = Resolve(g, o)
+		}
+		if err != nil {
+			t.Errorf("test %v: LoadFile(%v), QuoteChar %v\nGOT %v\nWANT nil", i, test.p, test.q, err)
+			continue
+		}
+		got := CountProductions(g, o)
+		if got.String() != test.want {
+			t.Errorf("test %v: CountProductions(%v), QuoteChar %v\nGOT %v\nWANT %v", i, test.p, test.q, got, test.want)
+		}
+	}
+}
+
+func TestCountRuleProductionsRecursive(t *testing.T) {
+	table := []struct {
+		s    string
+		d    int
+		want []string
+	}{
+		{s: "grammar a;\npublic <main> = <list>;\n<list> = a [and <list>];", d: 1, want: []string{"<list>", "<main>"}},
+		{s: "grammar a;\npublic <main> = <list>;\n<list> = a [and <list>];", d: 3, want: []string{"<list>", "<main>"}},
+		{s: "grammar a;\npublic <l> = \"<l>\" [and <l>];", d: 2, want: []string{"<l>"}},
+	}
+	for i, test := range table {
+		o := NewOptions()
+		o.MaxDepth = test.d
+		g, err := LoadString(test.s, o)
+		if err == nil {
+			g, err = Resolve(g, o)
+		}
+		if err != nil {
+			t.Errorf("test %v: LoadString(%v).err\nGOT %v\nWANT nil", i, test.s, err)
+			continue
+		}
+		got := slices.Sorted(maps.Keys(CountRuleProductions(g, o)))
+		if !slices.Equal(got, test.want) {
+			t.Errorf("test %v: CountRuleProductions(%v), MaxDepth %v\nGOT %v\nWANT %v", i, test.s, test.d, got, test.want)
+		}
+	}
+}
+
+func TestCountProductionsLarge(t *testing.T) {
+	table := []struct {
+		n    int
+		want string
+	}{
+		{n: 8, want: "100000000"},
+		{n: 40, want: "1" + strings.Repeat("0", 40)},
+	}
+	for i, test := range table {
+		s := "grammar a;\npublic <a> = " + strings.Repeat("<c> ", test.n) + ";\n<c> = 0 | 1 | 2 | 3 | 4 | 5 | 6 | 7 | 8 | 9;"
+		o := NewOptions()
+		g, err := LoadString(s, o)
+		if err == nil {
+			g, err = Resolve(g, o)
+		}
+		if err != nil {
+			t.Errorf("test %v: LoadString(%v).err\nGOT %v\nWANT nil", i, s, err)
+			continue
+		}
+		got := CountProductions(g, o)
+		if got.String() != test.want {
+			t.Errorf("test %v: CountProductions(%v)\nGOT %v\nWANT %v", i, s, got, test.want)
+		}
+	}
+}
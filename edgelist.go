@@ -3,10 +3,9 @@
 // Created on Mon Dec 30 05:00:25 PM EST 2024
 // author: Ryan Hildebrandt, github.com/ryancahildebrandt
 
-package main
+package gsgf
 
 import (
-	"fmt"
 	"slices"
 	"sort"
 )
@@ -75,16 +74,18 @@ func (e EdgeList) max() int {
 	return slices.Max(arr)
 }
 
-// Returns a slice of all unique edges in EdgeList e
+// Returns a slice of all unique edges in EdgeList e, keeping the first occurrence of each edge in its original order
+// Edge order determines the order children are visited in, so it is kept stable to produce productions in the same order on every run
 func Unique(e EdgeList) EdgeList {
 	var out EdgeList
-	var seen map[string]int = make(map[string]int)
+	var seen map[Edge]struct{} = make(map[Edge]struct{})
 
-	for i := range e {
-		seen[fmt.Sprint(e[i])] = i
-	}
-	for _, v := range seen {
-		out = append(out, e[v])
+	for _, edge := range e {
+		_, ok := seen[edge]
+		if !ok {
+			seen[edge] = struct{}{}
+			out = append(out, edge)
+		}
 	}
 
 	return out
@@ -92,65 +93,12 @@ func Unique(e EdgeList) EdgeList {
 
 // Converts a slice of tokens/Expressions to an EdgeList
 // Uses flow control tokens (), [], | to capture possible state transitions between tokens
+// Uses repetition tokens *, + to add loop edges from the end of the preceding item back to its start
+// The tokens are parsed into a syntax tree first, see parseTokens, and the edges are built from the tree
 // Every edgelist is constructed such that it has exactly one start and end node
-func ToEdgeList(arr []Expression) EdgeList {
-	var (
-		edges      EdgeList
-		from       int
-		group      int
-		groupStack []int
-		groupMap   = make(map[int][]int)
-	)
-
-	for i, token := range arr {
-		switch token {
-		case "<EOS>":
-			edges = append(edges, Edge{From: from, To: i, Weight: 1.0})
-		case "<SOS>":
-			from = i
-			groupStack = append(groupStack, i)
-			groupMap[i] = []int{}
-		case ";":
-			edges = append(edges, Edge{From: from, To: i, Weight: 1.0})
-			for _, v := range groupMap {
-				for _, v1 := range v {
-					edges = append(edges, Edge{From: v1, To: i, Weight: 1.0})
-				}
-			}
-			from = i
-		case "(", "[":
-			groupStack = append(groupStack, i)
-			groupMap[i] = []int{}
-			edges = append(edges, Edge{From: from, To: i, Weight: 1.0})
-			from = i
-		case ")":
-			group = groupStack[len(groupStack)-1]
-			for _, v := range groupMap[group] {
-				edges = append(edges, Edge{From: v, To: i, Weight: 1.0})
-			}
-			groupStack = groupStack[:len(groupStack)-1]
-			delete(groupMap, group)
-			edges = append(edges, Edge{From: from, To: i, Weight: 1.0})
-			from = i
-		case "]":
-			group = groupStack[len(groupStack)-1]
-			for _, v := range groupMap[group] {
-				edges = append(edges, Edge{From: v, To: i, Weight: 1.0})
-			}
-			groupStack = groupStack[:len(groupStack)-1]
-			delete(groupMap, group)
-			edges = append(edges, Edge{From: from, To: i, Weight: 1.0})
-			edges = append(edges, Edge{From: group, To: i, Weight: 1.0})
-			from = i
-		case "|":
-			group = groupStack[len(groupStack)-1]
-			groupMap[group] = append(groupMap[group], from)
-			from = group
-		default:
-			edges = append(edges, Edge{From: from, To: i, Weight: 1.0})
-			from = i
-		}
-	}
+// Returns the edges along with an ErrorList if the tokens cannot be parsed, in which case the edges cover the tree parsed so far
+func ToEdgeList(arr []Expression) (EdgeList, error) {
+	tree, err := parseTokens(arr, nil, nil)
 
-	return Unique(edges)
+	return treeEdges(tree, arr), err
 }
@@ -0,0 +1,124 @@
+// -*- coding: utf-8 -*-
+
+// Created on Sat Oct 17 06:36:12 AM EDT 2026
+// author: Ryan Hildebrandt, github.com/ryancahildebrandt
+
+package gsgf
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// Returns the text encoding for a charset named in a jsgf header, ignoring case, dashes, and underscores
+// Returns an error if the charset is not one of ISO-8859-1, Windows-1252, UTF-8, or UTF-16
+func getCharset(s string) (encoding.Encoding, error) {
+	switch strings.NewReplacer("-", "", "_", "").Replace(strings.ToUpper(s)) {
+	case "", "UTF8":
+		return unicode.UTF8, nil
+	case "UTF16":
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), nil
+	case "ISO88591", "LATIN1":
+		return charmap.ISO8859_1, nil
+	case "WINDOWS1252", "CP1252":
+		return charmap.Windows1252, nil
+	default:
+		return unicode.UTF8, fmt.Errorf("error when calling getCharset(%v):\n%+w", s, fmt.Errorf("%w, not one of ISO-8859-1, Windows-1252, UTF-8, UTF-16", ErrUnsupportedCharset))
+	}
+}
+
+// Returns the charset declared in the #JSGF header of a grammar file, or an empty string if there is none
+func peekCharset(b []byte) string {
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if strings.HasPrefix(line, "#JSGF") {
+			_, charset, _ := cleanHeaderStatement(line)
+
+			return charset
+		}
+	}
+
+	return ""
+}
+
+// Decodes the contents of a grammar file to UTF-8
+// - A UTF-8 byte order mark is removed, and UTF-16 text with a byte order mark is decoded
+// - Otherwise, text is decoded from the charset declared in the #JSGF header
+// - Text without a declared charset is returned as is if it is valid UTF-8
+// Returns an error if the declared charset is unsupported, or the text is not valid in its declared charset or, without one, in UTF-8
+func DecodeGrammar(b []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xEF, 0xBB, 0xBF}):
+		return b[3:], nil
+	case bytes.HasPrefix(b, []byte{0xFF, 0xFE}), bytes.HasPrefix(b, []byte{0xFE, 0xFF}):
+		res, err := unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder().Bytes(b)
+		if err != nil {
+			return b, fmt.Errorf("in DecodeGrammar():\n%+w", err)
+		}
+		return res, nil
+	}
+
+	charset := peekCharset(b)
+	enc, err := getCharset(charset)
+	if err != nil {
+		return b, fmt.Errorf("in DecodeGrammar():\n%+w", err)
+	}
+	if enc == unicode.UTF8 {
+		if !utf8.Valid(b) {
+			return b, fmt.Errorf("error when calling DecodeGrammar(), charset %v:\n%+w", charset, fmt.Errorf("%w, grammar is not valid UTF-8 and does not declare a single byte charset", ErrUnsupportedCharset))
+		}
+		return b, nil
+	}
+	res, err := enc.NewDecoder().Bytes(b)
+	if err != nil {
+		return b, fmt.Errorf("in DecodeGrammar():\n%+w", err)
+	}
+
+	return res, nil
+}
+
+// Reads and decodes a grammar file to a scanner over its UTF-8 contents
+func decodedScanner(r io.Reader) (*bufio.Scanner, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return &bufio.Scanner{}, fmt.Errorf("in decodedScanner():\n%+w", err)
+	}
+	b, err = DecodeGrammar(b)
+	if err != nil {
+		return &bufio.Scanner{}, fmt.Errorf("in decodedScanner():\n%+w", err)
+	}
+
+	return bufio.NewScanner(bytes.NewReader(b)), nil
+}
+
+// Encodes UTF-8 productions in the provided charset
+// Returns an error if the charset is unsupported or a production contains characters the charset cannot represent
+func EncodeProductions(p []string, charset string) ([]string, error) {
+	var res []string
+
+	enc, err := getCharset(charset)
+	if err != nil {
+		return p, fmt.Errorf("in EncodeProductions(%v):\n%+w", charset, err)
+	}
+	if enc == unicode.UTF8 {
+		return p, nil
+	}
+	for _, prod := range p {
+		e, err := enc.NewEncoder().String(prod)
+		if err != nil {
+			return p, fmt.Errorf("error when calling EncodeProductions(%v), production %v:\n%+w", charset, prod, err)
+		}
+		res = append(res, e)
+	}
+
+	return res, nil
+}
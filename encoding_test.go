@@ -0,0 +1,139 @@
+// -*- coding: utf-8 -*-
+
+// Created on Sat Oct 17 06:36:15 AM EDT 2026
+// author: Ryan Hildebrandt, github.com/ryancahildebrandt
+
+package gsgf
+
+import (
+	"os"
+	"slices"
+	"sort"
+	"testing"
+)
+
+func TestGetCharset(t *testing.T) {
+	table := []struct {
+		s       string
+		wantErr bool
+	}{
+		{s: "", wantErr: false},
+		{s: "UTF-8", wantErr: false},
+		{s: "utf8", wantErr: false},
+		{s: "UTF-16", wantErr: false},
+		{s: "ISO8859-1", wantErr: false},
+		{s: "ISO-8859-1", wantErr: false},
+		{s: "iso_8859_1", wantErr: false},
+		{s: "latin1", wantErr: false},
+		{s: "windows-1252", wantErr: false},
+		{s: "Cp1252", wantErr: false},
+		{s: "ISO8859-5", wantErr: true},
+		{s: "en", wantErr: true},
+	}
+	for i, test := range table {
+		_, err := getCharset(test.s)
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: getCharset(%v).err\nGOT %v\nWANT %v", i, test.s, err, test.wantErr)
+		}
+	}
+}
+
+func TestDecodeGrammar(t *testing.T) {
+	table := []struct {
+		b       []byte
+		want    string
+		wantErr bool
+	}{
+		{b: []byte(""), want: "", wantErr: false},
+		{b: []byte("abc"), want: "abc", wantErr: false},
+		{b: []byte("thé"), want: "thé", wantErr: false},
+		{b: []byte("#JSGF V1.0 ISO8859-1 fr;\nthé"), want: "#JSGF V1.0 ISO8859-1 fr;\nthÃ©", wantErr: false},
+		{b: []byte("#JSGF V1.0 UTF-8 fr;\nthé"), want: "#JSGF V1.0 UTF-8 fr;\nthé", wantErr: false},
+		{b: []byte("#JSGF V1.0;\nthé"), want: "#JSGF V1.0;\nthé", wantErr: false},
+		{b: []byte("\xEF\xBB\xBFthé"), want: "thé", wantErr: false},
+		{b: []byte("\xFF\xFEt\x00h\x00\xE9\x00"), want: "thé", wantErr: false},
+		{b: []byte("\xFE\xFF\x00t\x00h\x00\xE9"), want: "thé", wantErr: false},
+		{b: []byte("#JSGF V1.0 ISO8859-1 fr;\nth\xE9"), want: "#JSGF V1.0 ISO8859-1 fr;\nthé", wantErr: false},
+		{b: []byte("#JSGF V1.0 ISO8859-1;\nth\xE9 \x96"), want: "#JSGF V1.0 ISO8859-1;\nthé \u0096", wantErr: false},
+		{b: []byte("#JSGF V1.0 windows-1252 fr;\nth\xE9 \x96"), want: "#JSGF V1.0 windows-1252 fr;\nthé –", wantErr: false},
+		{b: []byte("#JSGF V1.0 UTF-8 fr;\nth\xE9"), want: "#JSGF V1.0 UTF-8 fr;\nth\xE9", wantErr: true},
+		{b: []byte("#JSGF V1.0;\nth\xE9"), want: "#JSGF V1.0;\nth\xE9", wantErr: true},
+		{b: []byte("th\xE9"), want: "th\xE9", wantErr: true},
+		{b: []byte("#JSGF V1.0 ISO8859-5 ru;\nth\xE9"), want: "#JSGF V1.0 ISO8859-5 ru;\nth\xE9", wantErr: true},
+		{b: []byte("#JSGF V1.0 ISO8859-5 ru;\nthé"), want: "#JSGF V1.0 ISO8859-5 ru;\nthé", wantErr: true},
+		{b: []byte("#JSGF V1.0 bogus-9;\nabc"), want: "#JSGF V1.0 bogus-9;\nabc", wantErr: true},
+	}
+	for i, test := range table {
+		got, err := DecodeGrammar(test.b)
+		if string(got) != test.want {
+			t.Errorf("test %v: DecodeGrammar(%q)\nGOT %q\nWANT %q", i, test.b, got, test.want)
+		}
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: DecodeGrammar(%q).err\nGOT %v\nWANT %v", i, test.b, err, test.wantErr)
+		}
+	}
+}
+
+func TestEncodeProductions(t *testing.T) {
+	table := []struct {
+		p       []string
+		c       string
+		want    []string
+		wantErr bool
+	}{
+		{p: []string{}, c: "ISO8859-1", want: []string{}, wantErr: false},
+		{p: []string{"abc", "thé"}, c: "", want: []string{"abc", "thé"}, wantErr: false},
+		{p: []string{"abc", "thé"}, c: "UTF-8", want: []string{"abc", "thé"}, wantErr: false},
+		{p: []string{"abc", "thé"}, c: "ISO8859-1", want: []string{"abc", "th\xE9"}, wantErr: false},
+		{p: []string{"thé –"}, c: "windows-1252", want: []string{"th\xE9 \x96"}, wantErr: false},
+		{p: []string{"thé –"}, c: "ISO8859-1", want: []string{"thé –"}, wantErr: true},
+		{p: []string{"thé"}, c: "ISO8859-5", want: []string{"thé"}, wantErr: true},
+	}
+	for i, test := range table {
+		got, err := EncodeProductions(test.p, test.c)
+		if !slices.Equal(got, test.want) && len(got)+len(test.want) > 0 {
+			t.Errorf("test %v: EncodeProductions(%v, %v)\nGOT %q\nWANT %q", i, test.p, test.c, got, test.want)
+		}
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: EncodeProductions(%v, %v).err\nGOT %v\nWANT %v", i, test.p, test.c, err, test.wantErr)
+		}
+	}
+}
+
+func TestDecodedScanner(t *testing.T) {
+	lexer := NewJSGFLexer("\"")
+	want := []string{"un thé ", "une tasse de thé ", "un thé glaçé", "une tasse de thé glaçé"}
+	table := []struct {
+		p       string
+		charset string
+		want    []string
+	}{
+		{p: "data/tests/encoding/latin1.jsgf", charset: "ISO8859-1", want: want},
+		{p: "data/tests/encoding/utf16.jsgf", charset: "UTF-16", want: want},
+		{p: "data/tests/encoding/utf8bom.jsgf", charset: "UTF-8", want: want},
+		{p: "data/tests/encoding/cp1252.jsgf", charset: "windows-1252", want: []string{"un thé  – merci", "une tasse de thé  – merci", "un thé glaçé – merci", "une tasse de thé glaçé – merci"}},
+	}
+	for i, test := range table {
+		f, err := os.Open(test.p)
+		if err != nil {
+			t.Errorf("test %v: os.Open(%v)\nGOT %v", i, test.p, err)
+		}
+		s, err := decodedScanner(f)
+		if err != nil {
+			t.Errorf("test %v: decodedScanner(%v)\nGOT %v", i, test.p, err)
+		}
+		g, err := FomJSGF(NewGrammar(), s, lexer)
+		if err != nil {
+			t.Errorf("test %v: FomJSGF(%v)\nGOT %v", i, test.p, err)
+		}
+		if g.Version != "V1.0" || g.Charset != test.charset || g.Locale != "fr" {
+			t.Errorf("test %v: FomJSGF(%v).header\nGOT %v %v %v\nWANT V1.0 %v fr", i, test.p, g.Version, g.Charset, g.Locale, test.charset)
+		}
+		got := GetAllProductions(g, 1)
+		sort.Strings(got)
+		sort.Strings(test.want)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("test %v: %v.Productions()\nGOT %v\nWANT %v", i, test.p, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// -*- coding: utf-8 -*-
+
+// Created on Sat Oct 17 03:05:38 PM EDT 2026
+// author: Ryan Hildebrandt, github.com/ryancahildebrandt
+
+package gsgf
+
+import "errors"
+
+// Errors returned when reading, importing, and resolving grammars, which can be checked with errors.Is
+// Errors at a position in a grammar file are wrapped in a SourceError, which can be retrieved with errors.As
+var (
+	// Grammar statements
+	ErrInvalidHeader      = errors.New("invalid jsgf header")
+	ErrInvalidName        = errors.New("invalid jsgf name declaration")
+	ErrInvalidImport      = errors.New("invalid jsgf import")
+	ErrInvalidRule        = errors.New("invalid jsgf rule")
+	ErrInvalidStatement   = errors.New("invalid jsgf statement, not a header, name declaration, import, or rule")
+	ErrInvalidWeight      = errors.New("invalid weight")
+	ErrDuplicateRule      = errors.New("duplicate rule definition")
+	ErrUnclosedComment    = errors.New("block comment is not closed")
+	ErrInvalidJJSGF       = errors.New("invalid jjsgf grammar")
+	ErrUnsupportedFormat  = errors.New("unsupported extension, not one of .jsgf, .jjsgf")
+	ErrUnsupportedCharset = errors.New("unsupported charset")
+
+	// Options
+	ErrInvalidOption = errors.New("invalid option")
+
+	// Imports
+	ErrGrammarNotFound = errors.New("grammar not found")
+	ErrPrivateRule     = errors.New("private rule referenced outside of its grammar")
+
+	// Rule resolution and productions
+	ErrUndefinedRule      = errors.New("undefined rule")
+	ErrAmbiguousReference = errors.New("ambiguous rule reference, rule is defined in more than one imported grammar")
+	ErrCyclicReference    = errors.New("cyclic rule reference")
+	ErrNoPublicRules      = errors.New("grammar has no public rules")
+	ErrIndexOutOfRange    = errors.New("production index out of range")
+	ErrProductionNotFound = errors.New("production not found")
+)
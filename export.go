@@ -3,10 +3,13 @@
 // Created on Sat Feb 22 10:19:30 PM EST 2025
 // author: Ryan Hildebrandt, github.com/ryancahildebrandt
 
-package main
+package gsgf
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
 	"slices"
 	"strings"
 )
@@ -35,12 +38,13 @@ type edgeJSON struct {
 type ruleJSON struct {
 	Expression string    `json:"expression"`
 	IsPublic   bool      `json:"is_public"`
+	Doc        string    `json:"doc,omitempty"`
 	Graph      graphJSON `json:"graph"`
 }
 
 // Construct ruleJSON from rule
-func ruleToJSON(r Rule) ruleJSON {
-	return ruleJSON{Expression: r.exp, IsPublic: r.IsPublic, Graph: graphToJSON(r.Graph)}
+func ruleToJSON(r Rule, n int) ruleJSON {
+	return ruleJSON{Expression: r.exp, IsPublic: r.IsPublic, Doc: r.Doc, Graph: graphToJSON(r.Graph, n)}
 }
 
 // Construct edgeJSON from edge
@@ -48,12 +52,12 @@ func edgeToJSON(e Edge) edgeJSON {
 	return edgeJSON(e)
 }
 
-// Construct graphJSON from graph
-func graphToJSON(g Graph) graphJSON {
+// Construct graphJSON from graph, repeating looped nodes in paths at most n times
+func graphToJSON(g Graph, n int) graphJSON {
 	var j graphJSON
 
 	j.Tokens = append(j.Tokens, g.Tokens...)
-	j.Paths = append(j.Paths, getAllPaths(g)...)
+	j.Paths = append(j.Paths, getAllPaths(g, n)...)
 	for _, i := range g.Edges {
 		j.Edges = append(j.Edges, edgeToJSON(i))
 	}
@@ -61,12 +65,14 @@ func graphToJSON(g Graph) graphJSON {
 	return j
 }
 
-// Construct grammarJSON from grammar
-func grammarToJSON(g Grammar) grammarJSON {
+// Construct grammarJSON from grammar, leaving out copies of recursive rules, see unrollRecursion
+func grammarToJSON(g Grammar, n int) grammarJSON {
 	var rules map[string]ruleJSON = make(map[string]ruleJSON)
 
 	for k, v := range g.Rules {
-		rules[k] = ruleToJSON(v)
+		if g.sourceRule(k) == k {
+			rules[k] = ruleToJSON(v, n)
+		}
 	}
 
 	return grammarJSON{Rules: rules, Imports: g.Imports}
@@ -131,8 +137,11 @@ func ReferencesToDOT(g Grammar) string {
 	builder.WriteString("digraph {\n\n")
 	builder.WriteString("\trankdir = \"LR\"\n\n")
 	for k, v := range g.Rules {
+		if g.sourceRule(k) != k {
+			continue
+		}
 		for _, r := range getReferences(v) {
-			entry = fmt.Sprintf("\t%s -> %s;\n", r, k)
+			entry = fmt.Sprintf("\t%s -> %s;\n", g.sourceRule(r), k)
 			entries = append(entries, entry)
 		}
 	}
@@ -183,8 +192,11 @@ func ReferencesToD2(g Grammar) string {
 
 	builder.WriteString("direction: right\n\n")
 	for k, v := range g.Rules {
+		if g.sourceRule(k) != k {
+			continue
+		}
 		for _, r := range getReferences(v) {
-			entry = fmt.Sprintf("\"%s\" -> \"%s\"\n", r, k)
+			entry = fmt.Sprintf("\"%s\" -> \"%s\"\n", g.sourceRule(r), k)
 			entries = append(entries, entry)
 		}
 	}
@@ -195,3 +207,51 @@ func ReferencesToD2(g Grammar) string {
 
 	return builder.String()
 }
+
+// Returns the json representation of a resolved grammar, including all paths of each rule graph
+func ExportJSON(g Grammar, o Options) ([]byte, error) {
+	j, err := json.Marshal(grammarToJSON(g, o.MaxRepeat))
+	if err != nil {
+		return j, fmt.Errorf("in ExportJSON(%v):\n%+w", g.Name, err)
+	}
+
+	return j, nil
+}
+
+// Writes json, d2, and dot representations of a resolved grammar and its rule references to directory d
+// - Each public rule's graph is also written as json, d2, dot, and txt node and edge lists
+// Returns an error if any of the files cannot be written
+func Export(g Grammar, d string, o Options) error {
+	var files map[string][]byte = make(map[string][]byte)
+
+	j, err := ExportJSON(g, o)
+	if err != nil {
+		return fmt.Errorf("in Export(%v, %v):\n%+w", g.Name, d, err)
+	}
+	files["grammar.json"] = j
+	files["references.d2"] = []byte(ReferencesToD2(g))
+	files["references.dot"] = []byte(ReferencesToDOT(g))
+	for k, v := range g.Rules {
+		if !v.IsPublic {
+			continue
+		}
+		j, err := json.Marshal(graphToJSON(v.Graph, o.MaxRepeat))
+		if err != nil {
+			return fmt.Errorf("in Export(%v, %v):\n%+w", g.Name, d, err)
+		}
+		nodes, edges := GraphToTXT(v.Graph)
+		files[k+"_graph.json"] = j
+		files[k+"_edges.txt"] = []byte(edges)
+		files[k+"_nodes.txt"] = []byte(nodes)
+		files[k+"_graph.d2"] = []byte(GraphToD2(v.Graph))
+		files[k+"_graph.dot"] = []byte(GraphToDOT(v.Graph))
+	}
+	for name, b := range files {
+		err = os.WriteFile(filepath.Join(d, name), b, 0644)
+		if err != nil {
+			return fmt.Errorf("in Export(%v, %v):\n%+w", g.Name, d, err)
+		}
+	}
+
+	return nil
+}
@@ -1,8 +1,14 @@
 // -*- coding: utf-8 -*-// Created on Sat Feb 22 10:19:34 PM EST 2025
 // author: Ryan Hildebrandt, github.com/ryancahildebrandt
-package main
+package gsgf
 
 import (
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 )
 
@@ -307,3 +313,93 @@ func TestReferencesToD2(t *testing.T) {
 		}
 	}
 }
+
+func TestExport(t *testing.T) {
+	table := []struct {
+		s       string
+		want    []string
+		wantErr bool
+	}{
+		{
+			s:       "grammar a;\npublic <main> = a | <b>;\n<b> = c;",
+			want:    []string{"<main>_edges.txt", "<main>_graph.d2", "<main>_graph.dot", "<main>_graph.json", "<main>_nodes.txt", "grammar.json", "references.d2", "references.dot"},
+			wantErr: false,
+		},
+		{
+			s:       "grammar a;\n<main> = a | b;",
+			want:    []string{"grammar.json", "references.d2", "references.dot"},
+			wantErr: false,
+		},
+	}
+	for i, test := range table {
+		var got []string
+		d := t.TempDir()
+		o := NewOptions()
+		g, err := LoadString(test.s, o)
+		if err != nil {
+			t.Errorf("test %v: LoadString(%v)\nGOT %v", i, test.s, err)
+		}
+		g, err = Resolve(g, o)
+		if err != nil {
+			t.Errorf("test %v: Resolve(%v)\nGOT %v", i, test.s, err)
+		}
+		err = Export(g, d, o)
+		entries, _ := os.ReadDir(d)
+		for _, e := range entries {
+			got = append(got, e.Name())
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("test %v: Export(%v)\nGOT %v\nWANT %v", i, test.s, got, test.want)
+		}
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: Export(%v).err\nGOT %v\nWANT %v", i, test.s, err, test.wantErr)
+		}
+	}
+	err := Export(NewGrammar(), filepath.Join(t.TempDir(), "missing"), NewOptions())
+	if err == nil {
+		t.Errorf("Export(missing dir).err\nGOT %v\nWANT true", err)
+	}
+}
+
+func TestExportJSONRecursive(t *testing.T) {
+	table := []struct {
+		s    string
+		d    int
+		want map[string]string
+	}{
+		{s: "grammar a;\npublic <main> = <list>;\n<list> = a [and <list>];", d: 2, want: map[string]string{"<list>": "a [and <list>];", "<main>": "<list>;"}},
+		{s: "grammar a;\npublic <l> = \"<l>\" [and <l>];", d: 1, want: map[string]string{"<l>": "\"<l>\" [and <l>];"}},
+	}
+	for i, test := range table {
+		var j grammarJSON
+
+		o := NewOptions()
+		o.MaxDepth = test.d
+		g, err := LoadString(test.s, o)
+		if err == nil {
+			g, err = Resolve(g, o)
+		}
+		if err != nil {
+			t.Errorf("test %v: LoadString(%v).err\nGOT %v\nWANT nil", i, test.s, err)
+			continue
+		}
+		b, err := ExportJSON(g, o)
+		if err == nil {
+			err = json.Unmarshal(b, &j)
+		}
+		if err != nil {
+			t.Errorf("test %v: ExportJSON(%v).err\nGOT %v\nWANT nil", i, test.s, err)
+			continue
+		}
+		got := make(map[string]string)
+		for k, v := range j.Rules {
+			got[k] = v.Expression
+		}
+		if !maps.Equal(got, test.want) {
+			t.Errorf("test %v: ExportJSON(%v), MaxDepth %v\nGOT %v\nWANT %v", i, test.s, test.d, got, test.want)
+		}
+		if strings.Contains(ReferencesToDOT(g), "@") {
+			t.Errorf("test %v: ReferencesToDOT(%v), MaxDepth %v\nGOT %v\nWANT no copies of recursive rules", i, test.s, test.d, ReferencesToDOT(g))
+		}
+	}
+}
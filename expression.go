@@ -3,12 +3,12 @@
 // Created on Wed Jan 22 08:07:03 PM EST 2025
 // author: Ryan Hildebrandt, github.com/ryancahildebrandt
 
-package main
+package gsgf
 
 import (
-	"errors"
 	"fmt"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -20,54 +20,205 @@ type Expression = string
 
 // Splits an expression into a slice of expression/tokens using tokenizer
 func ToTokens(e Expression, lex *tokenizer.Tokenizer) []Expression {
+	tokens, _ := ToTokenSpans(e, lex)
+
+	return tokens
+}
+
+// Byte offsets of a token within the expression it was read from, from Start up to but not including End
+type Span struct {
+	Start int
+	End   int
+}
+
+// Splits an expression into tokens as in ToTokens, along with the span of each token in the expression
+// - Tokens built from several lexer tokens, such as text, tags, and weights, span from the first to the last of them
+// - A quote starts a literal only at the start of a token, see opensQuote. A quote that starts a literal without closing it is kept as a token of its own, see unclosedLiterals
+// - <SOS> and <EOS> are given empty spans at the start and end of the expression
+func ToTokenSpans(e Expression, lex *tokenizer.Tokenizer) ([]Expression, []Span) {
 	if e == "" {
-		return []Expression{}
+		return []Expression{}, []Span{}
 	}
 
 	var (
 		res     string
 		builder strings.Builder
+		span    Span
 		out     []Expression      = []Expression{"<SOS>"}
+		spans   []Span            = []Span{{Start: 0, End: 0}}
 		stream  *tokenizer.Stream = lex.ParseString(e)
+		q       string            = getQuoteChar(lex)
 	)
 
+	// offset of the current lexer token, or the end of the expression once all tokens are consumed
+	offset := func() int {
+		if stream.IsValid() {
+			return stream.CurrentToken().Offset()
+		}
+		return len(e)
+	}
+	// sets the start of the builder's span if nothing has been written to it yet
+	begin := func() {
+		if builder.Len() == 0 {
+			span.Start = offset()
+		}
+	}
 	for stream.IsValid() {
 		switch {
 		case stream.CurrentToken().Is(SquareOpen, SquareClose, ParenthesisOpen, ParenthesisClose, Alternate, Semicolon):
 			builder, out = flushBuilder(builder, out)
+			spans = extendSpans(spans, out, span)
+			span.Start = offset()
 			res = stream.CurrentToken().ValueUnescapedString()
 			out = append(out, res)
 			stream.GoNext()
+			span.End = offset()
+			spans = extendSpans(spans, out, span)
+		case stream.CurrentToken().Is(KleeneStar, KleenePlus):
+			i := strings.LastIndexAny(strings.TrimRight(builder.String(), " \t"), " \t") + 1
+			n := len(out)
+			builder, out = flushLastWord(builder, out)
+			if len(out)-n == 2 {
+				spans = append(spans, Span{Start: span.Start, End: span.Start + i})
+				span.Start += i
+			}
+			spans = extendSpans(spans, out, span)
+			span.Start = offset()
+			res = stream.CurrentToken().ValueUnescapedString()
+			out = append(out, res)
+			stream.GoNext()
+			span.End = offset()
+			spans = extendSpans(spans, out, span)
 		case stream.CurrentToken().Is(BackSlash):
+			begin()
 			stream.GoNext()
 			builder.WriteString(stream.CurrentToken().ValueUnescapedString())
 			stream.GoNext()
+			span.End = offset()
 		case stream.CurrentToken().Is(ForwardSlash):
+			if strings.TrimSpace(builder.String()) == "" && isAlternativeStart(out) {
+				builder.Reset()
+			}
+			begin()
 			stream.GoNext()
 			builder.WriteString("/")
 			res, _ = captureString(stream, "/", true)
 			builder.WriteString(res)
-			builder, out = flushBuilder(builder, out)
 			stream.GoNext()
+			span.End = offset()
+			builder, out = flushBuilder(builder, out)
+			spans = extendSpans(spans, out, span)
 		case stream.CurrentToken().Is(AngleOpen):
 			builder, out = flushBuilder(builder, out)
+			spans = extendSpans(spans, out, span)
+			span.Start = offset()
 			res, _ = captureString(stream, ">", true)
 			out = append(out, res)
 			stream.GoNext()
+			span.End = offset()
+			spans = extendSpans(spans, out, span)
 		case stream.CurrentToken().Is(CurlyOpen):
+			begin()
 			res, _ = captureString(stream, "}", true)
 			builder.WriteString(res)
+			stream.GoNext()
+			span.End = offset()
+			builder, out = flushBuilder(builder, out)
+			spans = extendSpans(spans, out, span)
+		case stream.CurrentToken().Is(DoubleQuote, SingleQuote) && opensQuote(e, offset(), q) && quotedLength(e[offset():], q) < 0:
 			builder, out = flushBuilder(builder, out)
+			spans = extendSpans(spans, out, span)
+			span.Start = offset()
+			out = append(out, q)
 			stream.GoNext()
+			span.End = offset()
+			spans = extendSpans(spans, out, span)
+		case stream.CurrentToken().Is(DoubleQuote, SingleQuote) && opensQuote(e, offset(), q):
+			builder, out = flushBuilder(builder, out)
+			spans = extendSpans(spans, out, span)
+			begin()
+			end := span.Start + quotedLength(e[span.Start:], q)
+			res = unquoteLiteral(e[span.Start:end], q)
+			for stream.IsValid() && offset() < end {
+				stream.GoNext()
+			}
+			span.End = end
+			if isLiteral(res) {
+				out = append(out, res)
+				spans = extendSpans(spans, out, span)
+			} else {
+				builder.WriteString(res)
+			}
 		default:
+			begin()
 			builder.WriteString(stream.CurrentToken().ValueUnescapedString())
 			stream.GoNext()
+			span.End = offset()
 		}
 	}
 	builder, out = flushBuilder(builder, out)
+	spans = extendSpans(spans, out, span)
 	out = append(out, "<EOS>")
+	spans = append(spans, Span{Start: len(e), End: len(e)})
+
+	return out, spans
+}
+
+// Checks which tokens of an expression, as returned by ToTokenSpans, are rule references
+// Quoted or escaped text that reads like a rule reference, as in "<rule>", starts with a quote rather than < in the expression and is kept as text
+func referenceTokens(e Expression, tokens []Expression, spans []Span) []bool {
+	var res []bool = make([]bool, len(tokens))
+
+	for i, t := range tokens {
+		res[i] = i < len(spans) && spans[i].End > spans[i].Start && e[spans[i].Start] == '<' && strings.HasSuffix(t, ">")
+	}
+
+	return res
+}
+
+// Returns the rule references in an expression, in the order they appear, along with the span of each reference from < up to and including >
+func referenceSpans(e Expression, lex *tokenizer.Tokenizer) ([]Expression, []Span) {
+	var (
+		res   []Expression
+		spans []Span
+	)
+
+	tokens, s := ToTokenSpans(e, lex)
+	for i, ok := range referenceTokens(e, tokens, s) {
+		if ok {
+			res = append(res, tokens[i])
+			spans = append(spans, Span{Start: s[i].Start, End: s[i].Start + strings.Index(e[s[i].Start:], ">") + 1})
+		}
+	}
+
+	return res, spans
+}
+
+// Replaces each rule reference in an expression with the result of f, leaving the rest of the expression, including quoted text, as is
+func rewriteReferences(e Expression, lex *tokenizer.Tokenizer, f func(string) string) Expression {
+	var (
+		builder strings.Builder
+		last    int
+	)
 
-	return out
+	refs, spans := referenceSpans(e, lex)
+	for i, ref := range refs {
+		builder.WriteString(e[last:spans[i].Start])
+		builder.WriteString(f(ref))
+		last = spans[i].End
+	}
+	builder.WriteString(e[last:])
+
+	return builder.String()
+}
+
+// Helper function to give each token of o that does not have a span yet the span s
+func extendSpans(spans []Span, o []Expression, s Span) []Span {
+	for len(spans) < len(o) {
+		spans = append(spans, s)
+	}
+
+	return spans
 }
 
 // Helper function to get current contents of strings.Builder and reset
@@ -82,6 +233,99 @@ func flushBuilder(b strings.Builder, o []Expression) (strings.Builder, []Express
 	return b, o
 }
 
+// Helper function to flush strings.Builder, splitting off the last word as its own token
+// Used so that repetition operators * and + apply only to the immediately preceding word
+func flushLastWord(b strings.Builder, o []Expression) (strings.Builder, []Expression) {
+	var (
+		str   string = b.String()
+		start int    = strings.LastIndexAny(strings.TrimRight(str, " \t"), " \t") + 1
+	)
+
+	b.Reset()
+	if str[:start] != "" {
+		o = append(o, str[:start])
+	}
+	if str[start:] != "" {
+		o = append(o, str[start:])
+	}
+
+	return b, o
+}
+
+// Checks if the next token in o would be the first token of a group or alternative
+func isAlternativeStart(o []Expression) bool {
+	if len(o) == 0 {
+		return true
+	}
+	switch o[len(o)-1] {
+	case "<SOS>", "(", "[", "|":
+		return true
+	default:
+		return false
+	}
+}
+
+// Checks if a quoted literal can be kept as its own token without being read as a flow control token, weight, or rule reference
+func isLiteral(e Expression) bool {
+	switch {
+	case e == "", slices.Contains(jsgfFilter, e), isPrefixWeight(e):
+		return false
+	case strings.HasPrefix(e, "<") && strings.HasSuffix(e, ">"):
+		return false
+	default:
+		return true
+	}
+}
+
+// Check if an expression consists only of a weight, as in the jsgf spec /10/ a | /1/ b
+func isPrefixWeight(e Expression) bool {
+	return regexp.MustCompile(`^/[0-9\.]+/$`).MatchString(e)
+}
+
+// Checks that either all or none of the alternatives in each group are prefixed with a weight
+// Returns an error if only some alternatives of a group are weighted
+func ValidateWeights(e []Expression) error {
+	var (
+		alternatives []int
+		weighted     []int
+		start        bool
+	)
+
+	for _, t := range e {
+		switch t {
+		case "<SOS>", "(", "[":
+			alternatives = append(alternatives, 1)
+			weighted = append(weighted, 0)
+			start = true
+
+			continue
+		case "|":
+			if len(alternatives) > 0 {
+				alternatives[len(alternatives)-1]++
+			}
+			start = true
+
+			continue
+		case ")", "]", ";", "<EOS>":
+			if len(alternatives) == 0 {
+				continue
+			}
+			a, w := alternatives[len(alternatives)-1], weighted[len(weighted)-1]
+			alternatives, weighted = alternatives[:len(alternatives)-1], weighted[:len(weighted)-1]
+			if w != 0 && w != a {
+				return fmt.Errorf("error when calling ValidateWeights(%v), %v of %v alternatives weighted:\n%+w", e, w, a, fmt.Errorf("%w, weights must be provided for all alternatives in a group or none of them", ErrInvalidWeight))
+			}
+		default:
+			if start && isPrefixWeight(t) && len(weighted) > 0 {
+				weighted[len(weighted)-1]++
+			}
+		}
+		start = false
+	}
+
+	return nil
+}
+
 // Check if an espression has a weight defined by /[0-9\.]+/
 func isWeighted(e Expression) bool {
 	return regexp.MustCompile(`/[0-9\.]+/`).MatchString(e)
@@ -91,11 +335,11 @@ func isWeighted(e Expression) bool {
 func ParseWeight(e Expression) (Expression, float64, error) {
 	split := strings.Split(e, "/")
 	if len(split) != 3 {
-		return e, 0.0, fmt.Errorf("error when calling ParseWeight(%v), split into %v:\n%+w", e, split, errors.New("expression e not separable into expected 3 parts exp/weight/end. e may have the incorrect number of /"))
+		return e, 0.0, fmt.Errorf("error when calling ParseWeight(%v), split into %v:\n%+w", e, split, fmt.Errorf("%w, expression e not separable into expected 3 parts exp/weight/end. e may have the incorrect number of /", ErrInvalidWeight))
 	}
 	weight, err := strconv.ParseFloat(split[1], 64)
 	if err != nil {
-		return e, 0.0, fmt.Errorf("error when calling ParseWeight(%v), strconv.ParseFloat(%v, 64):\n%+w", e, split[1], err)
+		return e, 0.0, fmt.Errorf("error when calling ParseWeight(%v), strconv.ParseFloat(%v, 64):\n%w: %w", e, split[1], ErrInvalidWeight, err)
 	}
 
 	return split[0], weight, nil
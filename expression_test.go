@@ -3,10 +3,11 @@
 // Created on Wed Jan 22 08:12:27 PM EST 2025
 // author: Ryan Hildebrandt, github.com/ryancahildebrandt
 
-package main
+package gsgf
 
 import (
 	"slices"
+	"strings"
 	"testing"
 )
 
@@ -135,6 +136,42 @@ func TestToTokens(t *testing.T) {
 			e:    "test expression 123 (ab{1.1/1}|c{1.1/1}) | [de|f];",
 			want: []Expression{"<SOS>", "test expression 123 ", "(", "ab{1.1/1}", "|", "c{1.1/1}", ")", " ", "|", " ", "[", "de", "|", "f", "]", ";", "<EOS>"},
 		},
+		{
+			e:    "test expression 123+;",
+			want: []Expression{"<SOS>", "test expression ", "123", "+", ";", "<EOS>"},
+		},
+		{
+			e:    "test expression 123 *;",
+			want: []Expression{"<SOS>", "test expression ", "123 ", "*", ";", "<EOS>"},
+		},
+		{
+			e:    "test expression (123)* <rule>+ [abc]+;",
+			want: []Expression{"<SOS>", "test expression ", "(", "123", ")", "*", " ", "<rule>", "+", " ", "[", "abc", "]", "+", ";", "<EOS>"},
+		},
+		{
+			e:    "/10/ tea | /0.5/ coffee;",
+			want: []Expression{"<SOS>", "/10/", " tea ", "|", "/0.5/", " coffee", ";", "<EOS>"},
+		},
+		{
+			e:    "a ( /1/ b | /2/ <c>) [/3/ d|/4/e];",
+			want: []Expression{"<SOS>", "a ", "(", "/1/", " b ", "|", "/2/", " ", "<c>", ")", " ", "[", "/3/", " d", "|", "/4/", "e", "]", ";", "<EOS>"},
+		},
+		{
+			e:    "buy \"a|b (c)\" now;",
+			want: []Expression{"<SOS>", "buy ", "a|b (c)", " now", ";", "<EOS>"},
+		},
+		{
+			e:    "\"say \\\"hi\\\"\" | \"1/2\" cup;",
+			want: []Expression{"<SOS>", "say \"hi\"", " ", "|", " ", "1/2", " cup", ";", "<EOS>"},
+		},
+		{
+			e:    "\"a b\"* 'x;y';",
+			want: []Expression{"<SOS>", "a b", "*", " 'x", ";", "y'", ";", "<EOS>"},
+		},
+		{
+			e:    "a \"|\" \"<b>\";",
+			want: []Expression{"<SOS>", "a ", "| ", "<b>", ";", "<EOS>"},
+		},
 	}
 	for i, test := range table {
 		got := ToTokens(test.e, lexer)
@@ -142,6 +179,85 @@ func TestToTokens(t *testing.T) {
 			t.Errorf("test %v: %v.ToTokens(jsgflexer)\nGOT %v\nWANT %v", i, test.e, got, test.want)
 		}
 	}
+	lexer = NewJSGFLexer("'")
+	table = []struct {
+		e    Expression
+		want []Expression
+	}{
+		{
+			e:    "get 'x;y' [please];",
+			want: []Expression{"<SOS>", "get ", "x;y", " ", "[", "please", "]", ";", "<EOS>"},
+		},
+		{
+			e:    "'it\\'s' \"a|b\";",
+			want: []Expression{"<SOS>", "it's", " \"a", "|", "b\"", ";", "<EOS>"},
+		},
+		{
+			e:    "i'd like 'tea' | it's;",
+			want: []Expression{"<SOS>", "i'd like ", "tea", " ", "|", " it's", ";", "<EOS>"},
+		},
+	}
+	for i, test := range table {
+		got := ToTokens(test.e, lexer)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("test %v: %v.ToTokens(jsgflexer)\nGOT %v\nWANT %v", i, test.e, got, test.want)
+		}
+	}
+}
+
+func TestToTokenSpans(t *testing.T) {
+	lexer := NewJSGFLexer("\"")
+	table := []struct {
+		e    Expression
+		want []string
+	}{
+		{e: "", want: []string{}},
+		{e: "a b;", want: []string{"", "a b", ";", ""}},
+		{e: "<a> | <b.c>;", want: []string{"", "<a>", " ", "|", " ", "<b.c>", ";", ""}},
+		{e: "/2/ a {tag} | /1/ b;", want: []string{"", "/2/", " a {tag}", " ", "|", "/1/", " b", ";", ""}},
+		{e: "[a] (b)*;", want: []string{"", "[", "a", "]", " ", "(", "b", ")", "*", ";", ""}},
+		{e: "the cat+;", want: []string{"", "the ", "cat", "+", ";", ""}},
+		{e: "a\\|b \"c;d\";", want: []string{"", "a\\|b ", "\"c;d\"", ";", ""}},
+		{e: "thé <a>;", want: []string{"", "thé ", "<a>", ";", ""}},
+		{e: "say \"b | c;", want: []string{"", "say ", "\"", "b ", "|", " c", ";", ""}},
+		{e: "a\"b\" c;", want: []string{"", "a\"b\" c", ";", ""}},
+	}
+	for i, test := range table {
+		tokens, spans := ToTokenSpans(test.e, lexer)
+		if !slices.Equal(tokens, ToTokens(test.e, lexer)) {
+			t.Errorf("test %v: ToTokenSpans(%v).tokens\nGOT %v\nWANT %v", i, test.e, tokens, ToTokens(test.e, lexer))
+		}
+		var got []string = []string{}
+		for _, span := range spans {
+			got = append(got, test.e[span.Start:span.End])
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("test %v: ToTokenSpans(%v).spans\nGOT %q\nWANT %q", i, test.e, got, test.want)
+		}
+	}
+}
+
+func TestRewriteReferences(t *testing.T) {
+	lexer := NewJSGFLexer("\"")
+	table := []struct {
+		e    Expression
+		want Expression
+	}{
+		{e: "", want: ""},
+		{e: "a b;", want: "a b;"},
+		{e: "<a> | <b.c>;", want: "<x.a> | <x.b.c>;"},
+		{e: "say \"<a>\";", want: "say \"<a>\";"},
+		{e: "\"<a>\" [and <a>];", want: "\"<a>\" [and <x.a>];"},
+		{e: "thé <a>* {tag};", want: "thé <x.a>* {tag};"},
+	}
+	for i, test := range table {
+		got := rewriteReferences(test.e, lexer, func(r string) string {
+			return "<x." + strings.TrimPrefix(r, "<")
+		})
+		if got != test.want {
+			t.Errorf("test %v: rewriteReferences(%v)\nGOT %v\nWANT %v", i, test.e, got, test.want)
+		}
+	}
 }
 
 func TestParseWeight(t *testing.T) {
@@ -207,3 +323,31 @@ func TestIsWeighted(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateWeights(t *testing.T) {
+	lexer := NewJSGFLexer("\"")
+	table := []struct {
+		e       Expression
+		wantErr bool
+	}{
+		{e: "", wantErr: false},
+		{e: "a|b;", wantErr: false},
+		{e: "/1/ a;", wantErr: false},
+		{e: "/1/ a|/2/ b;", wantErr: false},
+		{e: "/1/ a|b;", wantErr: true},
+		{e: "a|/2/ b;", wantErr: true},
+		{e: "(/1/ a|/2/ b)|c;", wantErr: false},
+		{e: "(/1/ a|b)|c;", wantErr: true},
+		{e: "/1/ (a|b)|/2/ c;", wantErr: false},
+		{e: "[/1/ a|/0.5/ b|/0/ c] d;", wantErr: false},
+		{e: "[/1/ a|/0.5/ b|c] d;", wantErr: true},
+		{e: "a/1/|b;", wantErr: false},
+		{e: "x /1/|y;", wantErr: false},
+	}
+	for i, test := range table {
+		err := ValidateWeights(ToTokens(test.e, lexer))
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: ValidateWeights(%v)\nGOT %v\nWANT %v", i, test.e, err, test.wantErr)
+		}
+	}
+}
@@ -1,4 +1,4 @@
-module gsgf
+module github.com/ryancahildebrandt/gsgf
 
 go 1.23.5
 
@@ -9,3 +9,5 @@ require (
 )
 
 require golang.org/x/exp v0.0.0-20231110203233-9a3e6036ecaa
+
+require golang.org/x/text v0.21.0
@@ -3,21 +3,35 @@
 // Created on Tue Sep 17 11:55:23 AM EDT 2024
 // author: Ryan Hildebrandt, github.com/ryancahildebrandt
 
-package main
+package gsgf
 
 import (
 	"bufio"
-	"errors"
 	"fmt"
+	"iter"
+	"maps"
+	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/bzick/tokenizer"
 )
 
-// Contains rules and import statements from grammar file
+// Contains header, name, rules, and import statements from grammar file
+// Rules imported from other grammars are stored under their fully qualified names <gram.rule>
 type Grammar struct {
+	Name    string
+	Version string
+	Charset string
+	Locale  string
 	Rules   map[string]Rule
 	Imports []string
+	// Problems that do not stop the grammar from being used, such as a rule defined both in the grammar and in an imported grammar
+	Warnings ErrorList
+	// Names of rules whose statements could not be read, so that references to them are not also reported as undefined
+	invalid []string
+	// Copies of recursive rules made by unrollRecursion, keyed by the name of the copy, with the name of the rule they copy
+	copies map[string]string
 }
 
 func NewGrammar() Grammar {
@@ -43,36 +57,65 @@ func getCompositionOrder(g Grammar) []string {
 	}
 	for len(rules) > 0 {
 		rule, rules = rules[0], rules[1:]
-		rules = append(rules, getReferences(g.Rules[rule])...)
+		for _, ref := range getReferences(g.Rules[rule]) {
+			key, _ := resolveReference(ref, g.Rules)
+			if !isSpecialRule(key) {
+				rules = append(rules, key)
+			}
+		}
 		res = append(res, rule)
 	}
 
 	return res
 }
 
-// Collects productions for each public rule in the grammar
-func GetAllProductions(g Grammar) []string {
-	var productions []string
+// Collects productions for each public rule in the grammar, repeating looped tokens at most n times
+func GetAllProductions(g Grammar, n int) []string {
+	return slices.Collect(AllProductions(g, n))
+}
 
-	for _, v := range g.Rules {
-		if v.IsPublic {
-			productions = append(productions, getProductions(v)...)
+// Yields productions for each public rule in the grammar one at a time, in order of rule name, repeating looped tokens at most n times
+// Productions are generated as they are requested, so stopping early skips the work of generating the rest
+func AllProductions(g Grammar, n int) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		for _, k := range slices.Sorted(maps.Keys(g.Rules)) {
+			if !g.Rules[k].IsPublic {
+				continue
+			}
+			for prod := range ruleProductions(g.Rules[k], n) {
+				if !yield(prod) {
+					return
+				}
+			}
 		}
 	}
-
-	return productions
 }
 
 // Composes rule graphs into each other according to the composition order
-func ResolveRules(g Grammar, lex *tokenizer.Tokenizer) (Grammar, error) {
+// - If d > 0, recursive rules are expanded up to d levels deep before composition, see unrollRecursion
+// Returns an error if any rule references itself directly or indirectly after expansion, or references a rule that is not defined
+func ResolveRules(g Grammar, lex *tokenizer.Tokenizer, d int) (Grammar, error) {
+	var err error
+
+	if d > 0 {
+		g, err = unrollRecursion(g, d, lex)
+		if err != nil {
+			return g, err
+		}
+	}
+	err = ValidateGrammarRecursion(g)
+	if err != nil {
+		return g, err
+	}
+
 	var order []string = getCompositionOrder(g)
 	var seen map[string]struct{} = make(map[string]struct{})
 
 	for i := len(order) - 1; i >= 0; i-- {
 		rname := order[i]
-		r1 := g.Rules[rname]
+		r1, defined := g.Rules[rname]
 		_, ok := seen[rname]
-		if !ok {
+		if !ok && defined {
 			seen[rname] = struct{}{}
 
 			r2, err := ResolveReferences(r1, g.Rules, lex)
@@ -86,59 +129,283 @@ func ResolveRules(g Grammar, lex *tokenizer.Tokenizer) (Grammar, error) {
 	return g, nil
 }
 
-// Loads jsgf lines into a grammar, populating import statements and rules
+// Expands recursive rules into one copy per level of recursion, up to d levels deep
+// - Each rule that references itself, directly or through other rules, is copied as <rule@1> ... <rule@d>
+// - References between rules in the same cycle point to the copy one level deeper
+// - References from the deepest copies are replaced with <VOID>, so that no production follows them
+// Only rule references are rewritten, see rewriteReferences. Each rule and its copies keep the source expression of the rule, and copies are recorded so that they can be left out of counts and exports
+func unrollRecursion(g Grammar, d int, lex *tokenizer.Tokenizer) (Grammar, error) {
+	var (
+		reach  map[string]map[string]bool = make(map[string]map[string]bool)
+		rules  map[string]Rule            = make(map[string]Rule)
+		copies map[string]string          = make(map[string]string)
+	)
+
+	for k := range g.Rules {
+		reach[k] = getReachableRules(k, g.Rules)
+	}
+	for k, v := range g.Rules {
+		rules[k] = v
+		if !reach[k][k] {
+			continue
+		}
+		for i := 0; i <= d; i++ {
+			exp := rewriteReferences(v.exp, lex, func(ref string) string {
+				key, err := resolveReference(ref, g.Rules)
+				if err != nil || !reach[k][key] || !reach[key][k] {
+					return ref
+				}
+				if i == d {
+					return "<VOID>"
+				}
+				return depthName(key, i+1)
+			})
+			rule := NewRule(exp, false)
+			rule.pos, rule.tokenPos = v.pos, v.tokenPos
+			if i == 0 {
+				rule = v
+				rule.exp = exp
+			}
+			rule, err := parseExpansion(rule, lex)
+			if err != nil {
+				return g, fmt.Errorf("in unrollRecursion(%v, %v):\n%+w", g.Name, d, err)
+			}
+			rule, err = weightEdges(rule)
+			if err != nil {
+				return g, fmt.Errorf("in unrollRecursion(%v, %v):\n%+w", g.Name, d, err)
+			}
+			rule.exp = v.exp
+			rules[depthName(k, i)] = rule
+			if i > 0 {
+				copies[depthName(k, i)] = k
+			}
+		}
+	}
+	g.Rules, g.copies = rules, copies
+
+	return g, nil
+}
+
+// Returns the name of the rule that rule k was copied from by unrollRecursion, or k itself if it is not a copy
+func (g Grammar) sourceRule(k string) string {
+	n, ok := g.copies[k]
+	if ok {
+		return n
+	}
+
+	return k
+}
+
+// Returns the name of the copy of rule n at recursion depth i, where depth 0 is the rule itself
+func depthName(n string, i int) string {
+	if i == 0 {
+		return n
+	}
+
+	return fmt.Sprintf("%s@%v>", strings.TrimSuffix(n, ">"), i)
+}
+
+// Returns the set of rules reachable from rule n by following references, not including n unless it is part of a cycle
+func getReachableRules(n string, m map[string]Rule) map[string]bool {
+	var (
+		res   map[string]bool = make(map[string]bool)
+		queue []string        = []string{n}
+		rule  string
+	)
+
+	for len(queue) > 0 {
+		rule, queue = queue[0], queue[1:]
+		for _, ref := range getReferences(m[rule]) {
+			key, err := resolveReference(ref, m)
+			if err != nil || isSpecialRule(key) || res[key] {
+				continue
+			}
+			res[key] = true
+			queue = append(queue, key)
+		}
+	}
+
+	return res
+}
+
+// Loads jsgf statements into a grammar, populating header, name, import statements and rules
+// Statements may span multiple lines, and doc comments are attached to the rule that follows them
+// References qualified with the grammar's own name <name.rule> are stored as local references <rule>
+// Rules keep the line and column of their statements and tokens, see SourceError
+// Invalid statements, duplicate rule definitions, and rules with invalid weights are skipped, and reading continues with the next statement
+// Returns the grammar read from all valid statements, along with an ErrorList of every error found, sorted by position
 func FomJSGF(g Grammar, s *bufio.Scanner, lex *tokenizer.Tokenizer) (Grammar, error) {
-	for s.Scan() {
-		line := s.Text()
+	var errs ErrorList
+
+	statements, err := readStatements(s, getQuoteChar(lex))
+	if err != nil {
+		errs.add(err, Position{}, "")
+	}
+	for _, st := range statements {
+		line := st.text
 		switch {
+		case strings.HasPrefix(line, "#JSGF"):
+			err := ValidateJSGFHeader(line)
+			if err != nil {
+				errs = append(errs, &SourceError{Pos: st.source().position(0), Text: line, Err: err})
+				continue
+			}
+			g.Version, g.Charset, g.Locale = cleanHeaderStatement(line)
+		case strings.HasPrefix(line, "grammar "):
+			err := ValidateJSGFName(line)
+			if err != nil {
+				errs = append(errs, &SourceError{Pos: st.source().position(0), Text: line, Err: err})
+				continue
+			}
+			g.Name = cleanGrammarStatement(line)
 		case strings.HasPrefix(line, "import <"):
 			err := ValidateJSGFImport(line)
 			if err != nil {
-				return NewGrammar(), err
+				errs = append(errs, &SourceError{Pos: st.source().position(0), Text: line, Err: err})
+				continue
 			}
 			g.Imports = append(g.Imports, cleanImportStatement(line))
 		case strings.HasPrefix(line, "public <"), strings.HasPrefix(line, "<"):
-			err := ValidateJSGFRule(line)
+			name, rule, err := ParseRule(line, lex)
 			if err != nil {
-				return NewGrammar(), err
+				errs = append(errs, &SourceError{Pos: st.source().position(0), Text: line, Err: err})
+				g.invalid = append(g.invalid, invalidRuleName(line))
+				continue
 			}
-			name, rule, err := ParseRule(line, lex)
+			if g.Name != "" {
+				rule.exp = unqualifyReferences(rule.exp, g.Name, lex)
+			}
+			rule = setRuleSource(rule, st.source(), lex)
+			prev, ok := g.Rules[name]
+			if ok {
+				errs = append(errs, &SourceError{Pos: rule.pos, Text: name, Prev: prev.pos, Err: ErrDuplicateRule})
+				continue
+			}
+			rule, err = parseExpansion(rule, lex)
+			if err != nil {
+				errs.add(err, rule.pos, name)
+				g.invalid = append(g.invalid, name)
+				continue
+			}
+			rule, err = weightEdges(rule)
 			if err != nil {
-				return NewGrammar(), err
+				errs.add(err, rule.pos, name)
+				g.invalid = append(g.invalid, name)
+				continue
 			}
-			rule.Tokens = ToTokens(rule.exp, lex)
-			rule.Graph = NewGraph(ToEdgeList(rule.Tokens), rule.Tokens)
+			rule.Doc = st.doc
 			g.Rules[name] = rule
-		default:
+		case isEmptyStatement(line):
 			continue
+		default:
+			errs = append(errs, &SourceError{Pos: st.source().position(0), Text: line, Err: ErrInvalidStatement})
 		}
 	}
 
-	return g, nil
+	return g, errs.err()
+}
+
+// Returns the name of the rule declared by an invalid rule statement, or an empty string if it does not start with one
+func invalidRuleName(line string) string {
+	m := regexp.MustCompile(`^(?:public )?(<[^<>\s]+>)`).FindStringSubmatch(line)
+	if m == nil {
+		return ""
+	}
+
+	return m[1]
 }
 
 // Reads a namespace of available rules into a main grammar
-func ImportNameSpace(g Grammar, r map[string]string, lex *tokenizer.Tokenizer) Grammar {
+// Returns an error if any rule has an invalid weight
+func ImportNameSpace(g Grammar, r map[string]string, lex *tokenizer.Tokenizer) (Grammar, error) {
+	return importNameSpace(g, r, map[string]source{}, lex)
+}
+
+// Reads a namespace of available rules into a main grammar, positioning each rule at its statement in src if available
+func importNameSpace(g Grammar, r map[string]string, src map[string]source, lex *tokenizer.Tokenizer) (Grammar, error) {
 	for k, v := range r {
 		rule := NewRule(v, false)
-		rule.Tokens = ToTokens(rule.exp, lex)
-		rule.Graph = NewGraph(ToEdgeList(rule.Tokens), rule.Tokens)
-		_, ok := g.Rules[k]
+		st, ok := src[k]
+		if ok {
+			rule = setRuleSource(rule, st, lex)
+		}
+		rule, err := parseExpansion(rule, lex)
+		if err != nil {
+			return g, fmt.Errorf("in ImportNameSpace(%v), rule %v:\n%+w", g.Name, k, err)
+		}
+		rule, err = weightEdges(rule)
+		if err != nil {
+			return g, fmt.Errorf("in ImportNameSpace(%v), rule %v:\n%+w", g.Name, k, err)
+		}
+		_, ok = g.Rules[k]
 		if !ok {
 			g.Rules[k] = rule
 		}
 	}
 
-	return g
+	return g, nil
+}
+
+// Returns an error for each reference in the rules n of g that cannot be resolved
+// References to rules whose statements could not be read are skipped, as the statement itself is reported by FomJSGF
+func undefinedReferences(g Grammar, n []string) ErrorList {
+	var errs ErrorList
+
+	for _, k := range n {
+		for _, r := range getReferences(g.Rules[k]) {
+			_, err := resolveReference(r, g.Rules)
+			if err != nil && !slices.Contains(g.invalid, r) {
+				errs = append(errs, &SourceError{Pos: tokenPosition(g.Rules[k], r), Text: r, Err: err})
+			}
+		}
+	}
+
+	return errs
+}
+
+// Returns an error for each imported rule of g that is shadowed by a rule n defined in the grammar itself, read from a different file
+// - An imported rule is shadowed if it has the same fully qualified name as a local rule, or the same unqualified name, as in <lib.size> and a local <size>
+// - Rules with the same name in different imported grammars are not duplicates, and references that could point to more than one of them are reported by resolveReference
+func duplicateRules(g Grammar, n []string) ErrorList {
+	var errs ErrorList
+
+	for _, k := range n {
+		for _, r := range slices.Sorted(maps.Keys(g.Rules)) {
+			if slices.Contains(n, r) || g.Rules[r].pos.File == g.Rules[k].pos.File {
+				continue
+			}
+			if (g.Name != "" && r == qualifyReference(k, g.Name)) || "<"+r[strings.LastIndex(r, ".")+1:] == k {
+				errs = append(errs, &SourceError{Pos: g.Rules[r].pos, Text: r, Prev: g.Rules[k].pos, Err: ErrDuplicateRule})
+			}
+		}
+	}
+
+	return errs
+}
+
+// Checks that no rule in the grammar references itself, either directly or through other rules
+// Returns an error listing the full cycle of references, such as <a> -> <b> -> <a>
+func ValidateGrammarRecursion(g Grammar) error {
+	var done map[string]bool = make(map[string]bool)
+
+	for _, k := range slices.Sorted(maps.Keys(g.Rules)) {
+		cycle := visitReferences(k, g.Rules, []string{}, done)
+		if len(cycle) > 0 {
+			return fmt.Errorf("error when calling ValidateGrammarRecursion(%v):\n%+w", g.Name, cycleError(cycle, g.Rules))
+		}
+	}
+
+	return nil
 }
 
-// Checks that a grammar does not reference rules outside of itself, regardless of import statements
+// Checks that a grammar does not reference rules outside of itself or the special rules, regardless of import statements
+// Returns an error at the position of the first reference that cannot be resolved
 func ValidateGrammarCompleteness(g Grammar) error {
-	for _, v := range g.Rules {
-		for _, r := range getReferences(v) {
-			_, ok := g.Rules[r]
-			if !ok {
-				return fmt.Errorf("error when calling ValidateGrammarCompleteness(%v), on rule %v, reference %v:\n%+w", g, v, r, errors.New("grammar references rule not present in namespace"))
+	for _, k := range slices.Sorted(maps.Keys(g.Rules)) {
+		for _, r := range getReferences(g.Rules[k]) {
+			_, err := resolveReference(r, g.Rules)
+			if err != nil {
+				return fmt.Errorf("in ValidateGrammarCompleteness(%v), rule %v:\n%+w", g.Name, k, &SourceError{Pos: tokenPosition(g.Rules[k], r), Text: r, Err: err})
 			}
 		}
 	}
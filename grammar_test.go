@@ -3,7 +3,7 @@
 // Created on Mon Dec 30 05:00:54 PM EST 2024
 // author: Ryan Hildebrandt, github.com/ryancahildebrandt
 
-package main
+package gsgf
 
 import (
 	"bufio"
@@ -11,6 +11,7 @@ import (
 	"os"
 	"slices"
 	"sort"
+	"strings"
 	"testing"
 )
 
@@ -62,6 +63,13 @@ func TestGetCompositionOrder(t *testing.T) {
 			},
 			want: []string{"<a>", "<b>"},
 		},
+		{
+			g: Grammar{
+				Rules:   map[string]Rule{"<a>": NewRule("<NULL><b>|<VOID>", true)},
+				Imports: []string{},
+			},
+			want: []string{"<a>", "<b>"},
+		},
 		{
 			g: Grammar{
 				Rules: map[string]Rule{"<a>": NewRule("", true),
@@ -146,6 +154,17 @@ func TestGetCompositionOrder(t *testing.T) {
 			},
 			want: []string{},
 		},
+		{
+			g: Grammar{
+				Rules: map[string]Rule{
+					"<a>":   NewRule("<b><x.c>", true),
+					"<x.b>": NewRule("<x.c>", false),
+					"<x.c>": NewRule("", false),
+				},
+				Imports: []string{},
+			},
+			want: []string{"<a>", "<x.b>", "<x.c>", "<x.c>"},
+		},
 	}
 	for i, test := range table {
 		got := getCompositionOrder(test.g)
@@ -261,6 +280,26 @@ func TestGetAllProductions(t *testing.T) {
 			want:    []string{"abcabcabcabc"},
 			wantErr: false,
 		},
+		{
+			p:       []string{"abc<NULL>def;"},
+			want:    []string{"abcdef"},
+			wantErr: false,
+		},
+		{
+			p:       []string{"abc(<VOID>|def);"},
+			want:    []string{"abcdef"},
+			wantErr: false,
+		},
+		{
+			p:       []string{"abc<VOID>;", "[<a><VOID>]def;"},
+			want:    []string{"def"},
+			wantErr: false,
+		},
+		{
+			p:       []string{"abc(<NULL>|<VOID>|<a>)+;"},
+			want:    []string{"abc", "abc123"},
+			wantErr: false,
+		},
 		{
 			p:       []string{"abc;", "def;", "ghi;"},
 			want:    []string{"abc", "def", "ghi"},
@@ -472,11 +511,12 @@ func TestGetAllProductions(t *testing.T) {
 		for j, p := range test.p {
 			rule := NewRule(p, true)
 			rule.Tokens = ToTokens(rule.exp, lexer)
-			rule.Graph = NewGraph(ToEdgeList(rule.Tokens), rule.Tokens)
+			edges, _ := ToEdgeList(rule.Tokens)
+			rule.Graph = NewGraph(edges, rule.Tokens)
 			g.Rules[fmt.Sprintf("<pub_%v>", j)] = rule
 		}
-		g, err := ResolveRules(g, lexer)
-		got := GetAllProductions(g)
+		g, err := ResolveRules(g, lexer, 0)
+		got := GetAllProductions(g, 1)
 		sort.Strings(test.want)
 		sort.Strings(got)
 		if !slices.Equal(got, test.want) {
@@ -801,12 +841,13 @@ func TestGetAllProductionsMinimized(t *testing.T) {
 		for j, p := range test.p {
 			rule := NewRule(p, true)
 			rule.Tokens = ToTokens(rule.exp, lexer)
-			rule.Graph = NewGraph(ToEdgeList(rule.Tokens), rule.Tokens)
+			edges, _ := ToEdgeList(rule.Tokens)
+			rule.Graph = NewGraph(edges, rule.Tokens)
 			rule.Graph = Minimize(rule.Graph, jsgfFilter)
 			g.Rules[fmt.Sprintf("<pub_%v>", j)] = rule
 		}
-		g, err := ResolveRules(g, lexer)
-		got := GetAllProductions(g)
+		g, err := ResolveRules(g, lexer, 0)
+		got := GetAllProductions(g, 1)
 		sort.Strings(test.want)
 		sort.Strings(got)
 		if !slices.Equal(got, test.want) {
@@ -869,6 +910,31 @@ func TestGetAllProductionsJSGF(t *testing.T) {
 			want:    productions,
 			wantErr: false,
 		},
+		{
+			p:       "data/tests/test7.jsgf",
+			want:    productions,
+			wantErr: false,
+		},
+		{
+			p:       "data/tests/test8.jsgf",
+			want:    productions,
+			wantErr: false,
+		},
+		{
+			p:       "data/tests/test9.jsgf",
+			want:    []string{"<order> <quant> <teatype> tea", "<request> <quant> <teatype> tea"},
+			wantErr: true,
+		},
+		{
+			p:       "data/tests/test10.jsgf",
+			want:    []string{"<order> <quant> <teatype> tea", "<request> <quant> <teatype> tea"},
+			wantErr: true,
+		},
+		{
+			p:       "data/tests/test11.jsgf",
+			want:    []string{"<request> <quant> <teatype> tea"},
+			wantErr: true,
+		},
 		{
 			p:       "data/tests/a.jsgf",
 			want:    []string{},
@@ -901,11 +967,11 @@ func TestGetAllProductionsJSGF(t *testing.T) {
 		f, err1 := os.Open(test.p)
 		scanner := bufio.NewScanner(f)
 		grammar, err2 := FomJSGF(grammar, scanner, lexer)
-		namespace, err3 := CreateNameSpace(test.p, ".jsgf")
-		grammar = ImportNameSpace(grammar, namespace, lexer)
-		grammar, err4 := ResolveRules(grammar, lexer)
-		got := GetAllProductions(grammar)
-		for _, e := range []error{err1, err2, err3, err4} {
+		namespace, err3 := CreateNameSpaceFS(os.DirFS("."), test.p, nil, ".jsgf", "\"", false)
+		grammar, err4 := ImportNameSpace(grammar, namespace, lexer)
+		grammar, err5 := ResolveRules(grammar, lexer, 0)
+		got := GetAllProductions(grammar, 1)
+		for _, e := range []error{err1, err2, err3, err4, err5} {
 			if e != nil {
 				err = e
 			}
@@ -1000,14 +1066,13 @@ func TestGetAllProductionsJJSGF(t *testing.T) {
 	}
 	for i, test := range table {
 		var err error
-		grammar := NewGrammar()
-		scanner, err1 := fileScanner(test.p)
-		grammar, err2 := FomJSGF(grammar, scanner, lexer)
-		namespace, err3 := CreateNameSpace(test.p, ".jjsgf")
-		grammar = ImportNameSpace(grammar, namespace, lexer)
-		grammar, err4 := ResolveRules(grammar, lexer)
-		got := GetAllProductions(grammar)
-		for _, e := range []error{err1, err2, err3, err4} {
+		f, err1 := os.Open(test.p)
+		grammar, err2 := LoadJJSGF(f, NewOptions())
+		namespace, err3 := CreateNameSpaceFS(os.DirFS("."), test.p, nil, ".jjsgf", "\"", false)
+		grammar, err4 := ImportNameSpace(grammar, namespace, lexer)
+		grammar, err5 := ResolveRules(grammar, lexer, 0)
+		got := GetAllProductions(grammar, 1)
+		for _, e := range []error{err1, err2, err3, err4, err5} {
 			if e != nil {
 				err = e
 			}
@@ -1023,6 +1088,33 @@ func TestGetAllProductionsJJSGF(t *testing.T) {
 	}
 }
 
+func TestValidateGrammarRecursion(t *testing.T) {
+	tests := []struct {
+		g     Grammar
+		cycle string
+	}{
+		{g: Grammar{Rules: map[string]Rule{}}, cycle: ""},
+		{g: Grammar{Rules: map[string]Rule{"<a>": NewRule("abc;", true)}}, cycle: ""},
+		{g: Grammar{Rules: map[string]Rule{"<a>": NewRule("<b>;", true), "<b>": NewRule("<NULL>;", false)}}, cycle: ""},
+		{g: Grammar{Rules: map[string]Rule{"<a>": NewRule("<b><c>;", true), "<b>": NewRule("<c>;", false), "<c>": NewRule("abc;", false)}}, cycle: ""},
+		{g: Grammar{Rules: map[string]Rule{"<a>": NewRule("<a>;", true)}}, cycle: "<a> -> <a>"},
+		{g: Grammar{Rules: map[string]Rule{"<a>": NewRule("[<a>];", true)}}, cycle: "<a> -> <a>"},
+		{g: Grammar{Rules: map[string]Rule{"<a>": NewRule("<b>;", true), "<b>": NewRule("<a>;", false)}}, cycle: "<a> -> <b> -> <a>"},
+		{g: Grammar{Rules: map[string]Rule{"<a>": NewRule("<b>;", true), "<b>": NewRule("<c>;", false), "<c>": NewRule("x|<a>;", false)}}, cycle: "<a> -> <b> -> <c> -> <a>"},
+		{g: Grammar{Rules: map[string]Rule{"<a>": NewRule("<b>;", true), "<b>": NewRule("<c>;", false), "<c>": NewRule("<b>;", false)}}, cycle: "<b> -> <c> -> <b>"},
+		{g: Grammar{Rules: map[string]Rule{"<a>": NewRule("<x.b>;", true), "<x.b>": NewRule("<x.c>;", false), "<x.c>": NewRule("<x.b>;", false)}}, cycle: "<x.b> -> <x.c> -> <x.b>"},
+	}
+	for i, test := range tests {
+		err := ValidateGrammarRecursion(test.g)
+		if (err != nil) != (test.cycle != "") {
+			t.Errorf("test %v: ValidateGrammarRecursion(%v).err\nGOT %v\nWANT %v", i, test.g, err, test.cycle)
+		}
+		if err != nil && !strings.HasSuffix(err.Error(), "cyclic rule reference "+test.cycle) {
+			t.Errorf("test %v: ValidateGrammarRecursion(%v).err\nGOT %v\nWANT %v", i, test.g, err, test.cycle)
+		}
+	}
+}
+
 func TestValidateGrammarCompleteness(t *testing.T) {
 	tests := []struct {
 		g       Grammar
@@ -1063,6 +1155,13 @@ func TestValidateGrammarCompleteness(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			g: Grammar{
+				Rules:   map[string]Rule{"<a>": NewRule("<NULL>|<VOID>", true)},
+				Imports: []string{},
+			},
+			wantErr: false,
+		},
 		{
 			g: Grammar{
 				Rules: map[string]Rule{"<a>": NewRule("", true),
@@ -1155,6 +1254,27 @@ func TestValidateGrammarCompleteness(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			g: Grammar{
+				Rules:   map[string]Rule{"<a>": NewRule("<b><x.c>", true), "<x.b>": NewRule("", false), "<x.c>": NewRule("", false)},
+				Imports: []string{},
+			},
+			wantErr: false,
+		},
+		{
+			g: Grammar{
+				Rules:   map[string]Rule{"<a>": NewRule("<b>", true), "<x.b>": NewRule("", false), "<y.b>": NewRule("", false)},
+				Imports: []string{},
+			},
+			wantErr: true,
+		},
+		{
+			g: Grammar{
+				Rules:   map[string]Rule{"<a>": NewRule("<x.b>", true), "<x.b>": NewRule("", false), "<y.b>": NewRule("", false)},
+				Imports: []string{},
+			},
+			wantErr: false,
+		},
 	}
 	for i, test := range tests {
 		if err := ValidateGrammarCompleteness(test.g); (err != nil) != test.wantErr {
@@ -1162,3 +1282,161 @@ func TestValidateGrammarCompleteness(t *testing.T) {
 		}
 	}
 }
+
+func TestGetAllProductionsRepeated(t *testing.T) {
+	lexer := NewJSGFLexer("\"")
+	table := []struct {
+		p    string
+		r    int
+		m    bool
+		want []string
+	}{
+		{p: "public <main> = a+;", r: 1, m: false, want: []string{"a"}},
+		{p: "public <main> = a+;", r: 3, m: false, want: []string{"a", "a a", "a a a"}},
+		{p: "public <main> = a*;", r: 2, m: false, want: []string{"a", "a a"}},
+		{p: "public <main> = x a*;", r: 2, m: false, want: []string{"x ", "x a", "x a a"}},
+		{p: "public <main> = (a|b)+;", r: 2, m: false, want: []string{"a", "b", "a a", "a b", "b a", "b b"}},
+		{p: "public <main> = (a|b)+;", r: 2, m: true, want: []string{"a", "b", "a a", "a b", "b a", "b b"}},
+		{p: "public <main> = <digit>+;", r: 2, m: false, want: []string{"1", "2", "1 1", "1 2", "2 1", "2 2"}},
+		{p: "public <main> = <digit>+;", r: 2, m: true, want: []string{"1", "2", "1 1", "1 2", "2 1", "2 2"}},
+		{p: "public <main> = please* (tea)+;", r: 2, m: false, want: []string{" tea", " tea tea", "please tea", "please tea tea", "please please tea", "please please tea tea"}},
+		{p: "public <main> = a [b];", r: 0, m: false, want: []string{"a ", "a b"}},
+		{p: "public <main> = a [b]*;", r: 0, m: false, want: []string{"a "}},
+		{p: "public <main> = (<NULL>)+ x;", r: 2, m: false, want: []string{" x", " x"}},
+		{p: "public <main> = ((a)+ b)+;", r: 2, m: false, want: []string{"a b", "a b a b", "a b a a b", "a a b", "a a b a b", "a a b a a b"}},
+		{p: "public <main> = ((a)+ b)+;", r: 2, m: true, want: []string{"a b", "a b a b", "a b a a b", "a a b", "a a b a b", "a a b a a b"}},
+	}
+	for i, test := range table {
+		g := NewGrammar()
+		name, rule, err := ParseRule(test.p, lexer)
+		if err != nil {
+			t.Errorf("test %v: ParseRule(%v)\nGOT %v", i, test.p, err)
+		}
+		rule.Tokens = ToTokens(rule.exp, lexer)
+		edges, _ := ToEdgeList(rule.Tokens)
+		rule.Graph = NewGraph(edges, rule.Tokens)
+		g.Rules[name] = rule
+		g, err = ImportNameSpace(g, map[string]string{"<digit>": "1|2;"}, lexer)
+		if err != nil {
+			t.Errorf("test %v: ImportNameSpace(%v)\nGOT %v", i, test.p, err)
+		}
+		g, err = ResolveRules(g, lexer, 0)
+		if err != nil {
+			t.Errorf("test %v: ResolveRules(%v)\nGOT %v", i, test.p, err)
+		}
+		if test.m {
+			rule = g.Rules[name]
+			rule.Graph = Minimize(rule.Graph, jsgfFilter)
+			g.Rules[name] = rule
+		}
+		got := GetAllProductions(g, test.r)
+		sort.Strings(got)
+		sort.Strings(test.want)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("test %v: GetAllProductions(%v, %v)\nGOT %v\nWANT %v", i, test.p, test.r, got, test.want)
+		}
+	}
+}
+
+func TestFomJSGFExpansion(t *testing.T) {
+	lexer := NewJSGFLexer("\"")
+	table := []struct {
+		s    string
+		want map[string][]string
+	}{
+		{s: "grammar a;\npublic <a> = x <b>;\n<b> = y;", want: map[string][]string{"<a>": {"2:16 <b>"}, "<b>": {}}},
+		{s: "grammar a;\npublic <a> = x\n  [<b> | <a.c>]\n  <b>;\n<b> = y;\n<c> = z;", want: map[string][]string{"<a>": {"3:4 <b>", "3:10 <c>", "4:3 <b>"}, "<b>": {}, "<c>": {}}},
+		{s: "grammar t;\npublic <main> = say \"<t.x>\" <t.x>;\n<x> = y;", want: map[string][]string{"<main>": {"2:29 <x>"}, "<x>": {}}},
+	}
+	for i, test := range table {
+		g, err := FomJSGF(NewGrammar(), bufio.NewScanner(strings.NewReader(test.s)), lexer)
+		if err != nil {
+			t.Errorf("test %v: FomJSGF(%v).err\nGOT %v", i, test.s, err)
+		}
+		for k, v := range test.want {
+			var got []string
+			Walk(g.Rules[k].Expansion(), func(n Node) bool {
+				ref, ok := n.(*RuleRef)
+				if ok {
+					got = append(got, fmt.Sprintf("%v %v", ref.Pos, ref.Name))
+				}
+				return true
+			})
+			if !slices.Equal(got, v) && len(got)+len(v) > 0 {
+				t.Errorf("test %v: FomJSGF(%v).Rules[%v].Expansion()\nGOT %v\nWANT %v", i, test.s, k, got, v)
+			}
+		}
+	}
+}
+
+func TestFomJSGFDoc(t *testing.T) {
+	lexer := NewJSGFLexer("\"")
+	table := []struct {
+		s    string
+		want map[string]string
+	}{
+		{
+			s:    "<a> = b;",
+			want: map[string]string{"<a>": ""},
+		},
+		{
+			s:    "/** doc a */\n<a> = b;\n<c> = d;",
+			want: map[string]string{"<a>": "doc a", "<c>": ""},
+		},
+		{
+			s:    "/**\n * doc a\n */\npublic <a> = b;\n/** doc c */ <c> = d;",
+			want: map[string]string{"<a>": "doc a", "<c>": "doc c"},
+		},
+	}
+	for i, test := range table {
+		g, err := FomJSGF(NewGrammar(), bufio.NewScanner(strings.NewReader(test.s)), lexer)
+		if err != nil {
+			t.Errorf("test %v: FomJSGF(%v).err\nGOT %v", i, test.s, err)
+		}
+		for k, v := range test.want {
+			if g.Rules[k].Doc != v {
+				t.Errorf("test %v: FomJSGF(%v).Rules[%v].Doc\nGOT %v\nWANT %v", i, test.s, k, g.Rules[k].Doc, v)
+			}
+		}
+	}
+}
+
+func TestResolveRulesRecursive(t *testing.T) {
+	lexer := NewJSGFLexer("\"")
+	table := []struct {
+		p       string
+		d       int
+		want    []string
+		wantErr bool
+	}{
+		{p: "public <main> = <list>; <list> = a [and <list>];", d: 0, want: []string{}, wantErr: true},
+		{p: "public <main> = <list>; <list> = a [and <list>];", d: 1, want: []string{"a ", "a and a "}, wantErr: false},
+		{p: "public <main> = <list>; <list> = a [and <list>];", d: 2, want: []string{"a ", "a and a ", "a and a and a "}, wantErr: false},
+		{p: "public <list> = a [and <list>];", d: 1, want: []string{"a ", "a and a "}, wantErr: false},
+		{p: "public <main> = <list>; <list> = (a|b) [<list>];", d: 1, want: []string{"a ", "b ", "a a ", "a b ", "b a ", "b b "}, wantErr: false},
+		{p: "public <main> = <list>; <list> = a <list>;", d: 3, want: []string{}, wantErr: false},
+		{p: "public <main> = <a>; <a> = x [<b>]; <b> = y [<a>];", d: 2, want: []string{"x ", "x y ", "x y x "}, wantErr: false},
+		{p: "public <main> = <a> <b>; <a> = x [<a>]; <b> = y;", d: 1, want: []string{"x  y", "x x  y"}, wantErr: false},
+		{p: "public <main> = <a>; <a> = x [<a>];", d: 1, want: []string{"x ", "x x "}, wantErr: false},
+		{p: "public <l> = \"<l>\" [and <l>];", d: 1, want: []string{"<l> ", "<l> and <l> "}, wantErr: false},
+	}
+	for i, test := range table {
+		g, err := FomJSGF(NewGrammar(), bufio.NewScanner(strings.NewReader(test.p)), lexer)
+		if err != nil {
+			t.Errorf("test %v: FomJSGF(%v)\nGOT %v", i, test.p, err)
+		}
+		g, err = ResolveRules(g, lexer, test.d)
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: ResolveRules(%v, %v).err\nGOT %v\nWANT %v", i, test.p, test.d, err, test.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		got := GetAllProductions(g, 1)
+		slices.Sort(got)
+		slices.Sort(test.want)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("test %v: ResolveRules(%v, %v).Productions()\nGOT %v\nWANT %v", i, test.p, test.d, got, test.want)
+		}
+	}
+}
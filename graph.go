@@ -3,11 +3,13 @@
 // Created on Thu Sep  5 07:38:44 PM EDT 2024
 // author: Ryan Hildebrandt, github.com/ryancahildebrandt
 
-package main
+package gsgf
 
 import (
 	"errors"
 	"fmt"
+	"iter"
+	"maps"
 	mrand "math/rand/v2"
 	"slices"
 	"strings"
@@ -76,10 +78,11 @@ func (g Graph) addEdge(e Edge) Graph {
 // Returns a graph with:
 // - Specified node i removed
 // - All children of node i connected directly to all parents of node i (if not graph endpoints)
+// - Weights of the new edges set to the product of the weights of the edges they replace
 func (g Graph) dropNode(i int) Graph {
 	var (
-		from       []int
-		to         []int
+		from       EdgeList
+		to         EdgeList
 		edges      EdgeList
 		start, end int = getEndPoints(g)
 	)
@@ -89,9 +92,9 @@ func (g Graph) dropNode(i int) Graph {
 		case start, end:
 			edges = append(edges, edge)
 		case edge.From:
-			to = append(to, edge.To)
+			to = append(to, edge)
 		case edge.To:
-			from = append(from, edge.From)
+			from = append(from, edge)
 		default:
 			edges = append(edges, edge)
 		}
@@ -99,7 +102,7 @@ func (g Graph) dropNode(i int) Graph {
 
 	for _, f := range from {
 		for _, t := range to {
-			edges = append(edges, Edge{From: f, To: t, Weight: 1.0})
+			edges = append(edges, Edge{From: f.From, To: t.To, Weight: f.Weight * t.Weight})
 		}
 	}
 
@@ -140,36 +143,105 @@ func getEndPoints(g Graph) (int, int) {
 // Convenience type alias for a single graph traversal path
 type Path = []int
 
-// Returns all possible traversal paths between graph endpoints via depth first traversal
-func getAllPaths(g Graph) []Path {
+// Checks if node i of graph g is the special rule <VOID>
+func (g Graph) isVoid(i int) bool {
+	return i < len(g.Tokens) && g.Tokens[i] == "<VOID>"
+}
+
+// Returns all nodes from which the final node can be reached without passing through a <VOID> node
+func getLiveNodes(g Graph) map[int]struct{} {
 	var (
-		from, to int    = getEndPoints(g)
-		paths    []Path = []Path{{from}}
-		path     Path
-		res      []Path
-		tmp      Path
-		node     int
+		_, to   int              = getEndPoints(g)
+		parents map[int][]int    = make(map[int][]int)
+		queue   []int            = []int{to}
+		res     map[int]struct{} = map[int]struct{}{to: {}}
+		node    int
 	)
 
-	for len(paths) > 0 {
-		path, paths = paths[0], paths[1:]
-		node = path[len(path)-1]
-		if node == to {
-			res = append(res, path)
-
-			continue
-		}
-		for _, n := range g.getFrom(node) {
-			tmp = make(Path, len(path)+1)
-			copy(tmp, path)
-			tmp[len(path)] = n
-			paths = append(paths, tmp)
+	for _, e := range g.Edges {
+		parents[e.To] = append(parents[e.To], e.From)
+	}
+	for len(queue) > 0 {
+		node, queue = queue[0], queue[1:]
+		for _, p := range parents[node] {
+			_, ok := res[p]
+			if !ok && !g.isVoid(p) {
+				res[p] = struct{}{}
+				queue = append(queue, p)
+			}
 		}
 	}
 
 	return res
 }
 
+// Helper function to check if a node is in a set of nodes such as the one returned by getLiveNodes
+func isLive(live map[int]struct{}) func(int) bool {
+	return func(n int) bool {
+		_, ok := live[n]
+		return ok
+	}
+}
+
+// Returns all possible traversal paths between graph endpoints via depth first traversal
+// Repetition loops are repeated at most r times each time they are entered, see graphLoops, and paths through <VOID> are pruned
+func getAllPaths(g Graph, r int) []Path {
+	var res []Path
+
+	for path := range allPaths(g, r) {
+		res = append(res, slices.Clone(path))
+	}
+
+	return res
+}
+
+// Yields each traversal path between graph endpoints, one at a time and in depth first order
+// Only the current path and the next child to visit at each of its nodes are kept in memory, so memory use is proportional to path length
+// The yielded path is reused between iterations, and must be copied to be kept
+func allPaths(g Graph, r int) iter.Seq[Path] {
+	from, _ := getEndPoints(g)
+
+	return pathsFrom(g, r, Path{from}, []int{0})
+}
+
+// Yields traversal paths in the same order as allPaths, resuming the traversal from path p
+// next holds the index of the next child to visit at each node of p, and is 0 for the last node
+func pathsFrom(g Graph, r int, p Path, next []int) iter.Seq[Path] {
+	return func(yield func(Path) bool) {
+		var (
+			_, to int              = getEndPoints(g)
+			live  map[int]struct{} = getLiveNodes(g)
+			loops graphLoops       = getLoops(g, isLive(live))
+			path  Path             = slices.Clone(p)
+			next  []int            = slices.Clone(next)
+		)
+
+		for len(path) > 0 {
+			node, i := path[len(path)-1], next[len(next)-1]
+			if node == to {
+				if !yield(path) {
+					return
+				}
+				path, next = path[:len(path)-1], next[:len(next)-1]
+
+				continue
+			}
+			children := g.getFrom(node)
+			if i >= len(children) {
+				path, next = path[:len(path)-1], next[:len(next)-1]
+
+				continue
+			}
+			next[len(next)-1]++
+			_, ok := live[children[i]]
+			if !ok || !loops.allows(path, children[i], r) {
+				continue
+			}
+			path, next = append(path, children[i]), append(next, 0)
+		}
+	}
+}
+
 // Inserts graph g into graph g1 at node i
 // - Increments g1.Edges by g.Edges.Max+1
 // - Appends g.Tokens onto g1.Tokens
@@ -178,11 +250,11 @@ func getAllPaths(g Graph) []Path {
 func composeGraphs(g Graph, g1 Graph, i int) (Graph, error) {
 	switch {
 	case g.Edges.isEmpty() || g1.Edges.isEmpty():
-		return Graph{}, fmt.Errorf("error when calling ComposeGraphs(%v, %v, %v):\n%+w", g, g1, i, errors.New("one or more EdgeLists e and a are empty"))
+		return Graph{}, fmt.Errorf("error when calling ComposeGraphs(%v):\n%+w", i, errors.New("one or more EdgeLists g and g1 are empty"))
 	case i < 0:
-		return Graph{}, fmt.Errorf("error when calling ComposeGraphs(%v, %v, %v):\n%+w", g, g1, i, errors.New("cannot insert EdgeList a at negative index"))
+		return Graph{}, fmt.Errorf("error when calling ComposeGraphs(%v):\n%+w", i, errors.New("cannot insert EdgeList g1 at negative index"))
 	case i > g.Edges.max():
-		return Graph{}, fmt.Errorf("error when calling ComposeGraphs(%v, %v, %v):\n%+w", g, g1, i, errors.New("cannot insert EdgeList g1 at index greater than EdgeList g.Max()"))
+		return Graph{}, fmt.Errorf("error when calling ComposeGraphs(%v):\n%+w", i, errors.New("cannot insert EdgeList g1 at index greater than EdgeList g.Max()"))
 	}
 
 	g1.Edges = increment(g1.Edges, g.Edges.max()+1)
@@ -223,21 +295,30 @@ func getRandomChoice(c []int, w []float64, s xrand.Source) (int, error) {
 }
 
 // Returns one traversal path between graph endpoints, choosing nodes according to provided or default weights
+// Repetition loops are repeated at most r times each time they are entered, see graphLoops, and nodes leading only to <VOID> are never chosen
 // Returns an error if the target node is not reachable
-func getRandomPath(g Graph) (Path, error) {
+func getRandomPath(g Graph, r int) (Path, error) {
 	var (
-		source   xrand.Source = xrand.NewSource(mrand.Uint64())
-		from, to int          = getEndPoints(g)
-		res      Path         = Path{from}
-		node     int          = from
+		source   xrand.Source     = xrand.NewSource(mrand.Uint64())
+		from, to int              = getEndPoints(g)
+		live     map[int]struct{} = getLiveNodes(g)
+		loops    graphLoops       = getLoops(g, isLive(live))
+		res      Path             = Path{from}
+		node     int              = from
 		choice   int
 	)
 
 	for node != to {
-		n := g.getFrom(node)
+		var n []int
+		for _, dest := range g.getFrom(node) {
+			_, ok := live[dest]
+			if ok && loops.allows(res, dest, r) {
+				n = append(n, dest)
+			}
+		}
 		switch len(n) {
 		case 0:
-			return Path{}, fmt.Errorf("error when calling GetRandomPath(%v), GetFrom(%v):\n%+w", g, n, errors.New("cannot proceed further down path, no nodes are reachable from n"))
+			return Path{}, fmt.Errorf("error when calling GetRandomPath(%v), GetFrom(%v):\n%+w", r, node, errors.New("cannot proceed further down path, no nodes are reachable from node"))
 		case 1:
 			choice = n[0]
 			res = append(res, choice)
@@ -245,12 +326,12 @@ func getRandomPath(g Graph) (Path, error) {
 		default:
 			w := make([]float64, len(n))
 			for i, dest := range n {
-				w[i] = g.getWeight(from, dest)
+				w[i] = g.getWeight(node, dest)
 			}
 
-			choice, err := getRandomChoice(g.getFrom(node), w, source)
+			choice, err := getRandomChoice(n, w, source)
 			if err != nil {
-				return Path{}, fmt.Errorf("in GetRandomPath(%v):\n%+w", g, err)
+				return Path{}, fmt.Errorf("in GetRandomPath(%v):\n%+w", r, err)
 			}
 			res = append(res, choice)
 			node = choice
@@ -261,11 +342,14 @@ func getRandomPath(g Graph) (Path, error) {
 }
 
 // Drops "" nodes from a graph, as they do not contribute anything to productions
+// Nodes inside of repetition loops are kept so that repeat counts are unchanged
 func Minimize(g Graph, f []string) Graph {
 	var g1 Graph = g
+	var loops map[int]struct{} = getLoopNodes(g)
 
 	for i, t := range g1.Tokens {
-		if slices.Contains(f, t) {
+		_, ok := loops[i]
+		if slices.Contains(f, t) && !ok {
 			g1 = g1.dropNode(i)
 		}
 	}
@@ -273,13 +357,191 @@ func Minimize(g Graph, f []string) Graph {
 	return g1
 }
 
+// Returns all nodes which are part of a cycle in the graph, as introduced by repetition tokens * and +
+func getLoopNodes(g Graph) map[int]struct{} {
+	var res map[int]struct{} = make(map[int]struct{})
+
+	for n := range getLoops(g, func(int) bool { return true }).in {
+		res[n] = struct{}{}
+	}
+
+	return res
+}
+
+// Written between the repetitions of a loop in productions, so that repeated items are separated as in "please please tea"
+const repeatSeparator Expression = " "
+
+// Repetition loops of a graph, as introduced by repetition tokens * and +
+// - Each loop is a strongly connected component of the graph, entered through its entry nodes, such as the first token of a repeated group
+// - Loops nested inside of a loop, as in ((a)+ b)+, are the strongly connected components of the loop once its entry nodes are removed
+// - Each visit to an entry node of a loop starts another iteration of it. Iterations are counted from 0 each time the loop is entered, so a nested loop can be repeated again in each iteration of the loops around it
+type graphLoops struct {
+	n     int
+	in    map[int][]int
+	entry map[int][]int
+}
+
+// Returns the loops of graph g among the nodes for which keep returns true that can be reached from the initial node through them
+func getLoops(g Graph, keep func(int) bool) graphLoops {
+	var (
+		res     graphLoops    = graphLoops{in: make(map[int][]int), entry: make(map[int][]int)}
+		from, _               = getEndPoints(g)
+		parents map[int][]int = make(map[int][]int)
+		nodes   map[int]bool  = make(map[int]bool)
+		queue   []int
+		node    int
+	)
+
+	if keep(from) {
+		nodes[from], queue = true, []int{from}
+	}
+	for len(queue) > 0 {
+		node, queue = queue[0], queue[1:]
+		for _, n := range g.getFrom(node) {
+			if keep(n) {
+				parents[n] = append(parents[n], node)
+			}
+			if keep(n) && !nodes[n] {
+				nodes[n] = true
+				queue = append(queue, n)
+			}
+		}
+	}
+	res.find(g, nodes, parents)
+
+	return res
+}
+
+// Adds each loop among nodes, following only edges between them, followed by the loops nested inside of it
+func (x *graphLoops) find(g Graph, nodes map[int]bool, parents map[int][]int) {
+	for _, c := range getComponents(g, nodes) {
+		if len(c) == 1 && !slices.Contains(g.getFrom(c[0]), c[0]) {
+			continue
+		}
+		l := x.n
+		x.n++
+		inner := make(map[int]bool)
+		for _, n := range c {
+			x.in[n] = append(x.in[n], l)
+			inner[n] = true
+		}
+		for _, n := range c {
+			if slices.ContainsFunc(parents[n], func(p int) bool { return !inner[p] }) {
+				x.entry[n] = append(x.entry[n], l)
+			}
+		}
+		for _, n := range c {
+			if slices.Contains(x.entry[n], l) {
+				delete(inner, n)
+			}
+		}
+		x.find(g, inner, parents)
+	}
+}
+
+// Checks if node n is part of loop l
+func (x graphLoops) contains(l int, n int) bool {
+	return slices.Contains(x.in[n], l)
+}
+
+// Returns the number of iterations of loop l since path p last entered it, which is 0 if p does not end inside of the loop
+func (x graphLoops) iterations(p Path, l int) int {
+	var res int
+
+	for i := len(p) - 1; i >= 0 && x.contains(l, p[i]); i-- {
+		if slices.Contains(x.entry[p[i]], l) {
+			res++
+		}
+	}
+
+	return res
+}
+
+// Checks if moving from node u to node n starts another iteration of a loop that u is already part of, as when a repeated item loops back to its start
+func (x graphLoops) repeats(u int, n int) bool {
+	return slices.ContainsFunc(x.entry[n], func(l int) bool { return x.contains(l, u) })
+}
+
+// Checks if path p can continue to node n without repeating any loop more than r times
+func (x graphLoops) allows(p Path, n int, r int) bool {
+	for _, l := range x.entry[n] {
+		if x.iterations(p, l) >= r {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Returns the strongly connected components among nodes, following only edges between them, with Tarjan's algorithm
+// Components are returned in the order they are completed, starting the search from nodes in increasing order
+func getComponents(g Graph, nodes map[int]bool) [][]int {
+	var (
+		counter int
+		stack   []int
+		index   map[int]int  = make(map[int]int)
+		low     map[int]int  = make(map[int]int)
+		onStack map[int]bool = make(map[int]bool)
+		res     [][]int
+		connect func(n int)
+	)
+
+	connect = func(n int) {
+		index[n], low[n] = counter, counter
+		counter++
+		stack = append(stack, n)
+		onStack[n] = true
+		for _, c := range g.getFrom(n) {
+			_, ok := index[c]
+			switch {
+			case !nodes[c]:
+				continue
+			case !ok:
+				connect(c)
+				low[n] = min(low[n], low[c])
+			case onStack[c]:
+				low[n] = min(low[n], index[c])
+			}
+		}
+		if low[n] != index[n] {
+			return
+		}
+		var component []int
+		for {
+			c := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[c] = false
+			component = append(component, c)
+			if c == n {
+				break
+			}
+		}
+		res = append(res, component)
+	}
+
+	for _, n := range slices.Sorted(maps.Keys(nodes)) {
+		_, ok := index[n]
+		if !ok {
+			connect(n)
+		}
+	}
+
+	return res
+}
+
 // Applies expression weights to rule tokens if present
+// Weights prefixing an alternative (/10/ a | /1/ b) are applied to the edge entering that alternative
+// Returns an error if a weight cannot be parsed or only some alternatives in a group are weighted
 func weightEdges(r Rule) (Rule, error) {
+	err := ValidateWeights(r.Tokens)
+	if err != nil {
+		return r, fmt.Errorf("in WeightEdges(%v):\n%+w", r.exp, &SourceError{Pos: r.pos, Msg: "weights must be provided for all alternatives in a group or none of them", Err: err})
+	}
 	for i, t := range r.Tokens {
 		if isWeighted(t) {
 			exp, weight, err := ParseWeight(t)
 			if err != nil {
-				return r, fmt.Errorf("in WeightEdges(%v):\n%+w", r, err)
+				return r, fmt.Errorf("in WeightEdges(%v):\n%+w", r.exp, &SourceError{Pos: tokenPosition(r, t), Msg: ErrInvalidWeight.Error(), Text: strings.TrimSpace(t), Err: err})
 			}
 			r.Tokens[i] = exp
 			r.Graph.Tokens[i] = exp
@@ -290,32 +552,51 @@ func weightEdges(r Rule) (Rule, error) {
 			}
 		}
 	}
+	r.Graph = NewGraph(r.Graph.Edges, r.Graph.Tokens)
 
 	return r, nil
 }
 
-// Collects productions from each path in r.Graph
-func getProductions(r Rule) []string {
-	var productions []string
-	for _, path := range getAllPaths(r.Graph) {
-		prod := getSingleProduction(path, filterTokens(getTokens(r), jsgfFilter))
-		if prod != "" {
-			productions = append(productions, prod)
+// Collects productions from each path in r.Graph, repeating looped nodes at most n times
+func getProductions(r Rule, n int) []string {
+	return slices.Collect(ruleProductions(r, n))
+}
+
+// Yields the production of each path in r.Graph as it is found, repeating looped nodes at most n times
+// Empty productions are skipped
+func ruleProductions(r Rule, n int) iter.Seq[string] {
+	from, _ := getEndPoints(r.Graph)
+
+	return ruleProductionsFrom(r, n, Path{from}, []int{0})
+}
+
+// Yields productions in the same order as ruleProductions, resuming from path p, see pathsFrom
+func ruleProductionsFrom(r Rule, n int, p Path, next []int) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		tokens := filterTokens(getTokens(r), jsgfFilter)
+		loops := getLoops(r.Graph, isLive(getLiveNodes(r.Graph)))
+		for path := range pathsFrom(r.Graph, n, p, next) {
+			prod := getSingleProduction(path, tokens, loops)
+			if prod != "" && !yield(prod) {
+				return
+			}
 		}
 	}
-
-	return productions
 }
 
 // Returns a production by mapping a graph traversal path to a slice of tokens
-func getSingleProduction(p Path, a []Expression) string {
+// Each repetition of a loop after the first is preceded by repeatSeparator, unless nothing has been produced yet, see graphLoops.repeats
+func getSingleProduction(p Path, a []Expression, loops graphLoops) string {
 	if len(p) == 0 || len(a) == 0 {
 		return ""
 	}
 
 	var builder strings.Builder
 
-	for _, i := range p {
+	for j, i := range p {
+		if j > 0 && builder.Len() > 0 && loops.repeats(p[j-1], i) {
+			builder.WriteString(repeatSeparator)
+		}
 		builder.WriteString(a[i])
 	}
 
@@ -3,14 +3,17 @@
 // Created on Thu Nov  7 08:51.08 PM EST 2024
 // author: Ryan Hildebrandt, github.com/ryancahildebrandt
 
-package main
+package gsgf
 
 import (
+	"bufio"
 	"fmt"
 	"maps"
+	"math"
 	mrand "math/rand/v2"
 	"slices"
 	"sort"
+	"strings"
 	"testing"
 
 	xrand "golang.org/x/exp/rand"
@@ -952,7 +955,7 @@ func TestGetAllPaths(t *testing.T) {
 	for i, test := range table {
 		g := NewGraph(test.e,
 			[]Expression{})
-		got := getAllPaths(g)
+		got := getAllPaths(g, 1)
 		sort.Slice(got, func(i, j int) bool { return fmt.Sprint(got[i]) < fmt.Sprint(got[j]) })
 		sort.Slice(test.want, func(i, j int) bool { return fmt.Sprint(test.want[i]) < fmt.Sprint(test.want[j]) })
 		for n := range got {
@@ -1862,7 +1865,7 @@ func TestGetRandomPath(t *testing.T) {
 	}
 	for i, test := range table {
 		g := NewGraph(test.e, []Expression{})
-		got, err := getRandomPath(g)
+		got, err := getRandomPath(g, 1)
 		found := false
 		for _, p := range test.want {
 			if slices.Equal(got, p) {
@@ -1878,6 +1881,56 @@ func TestGetRandomPath(t *testing.T) {
 	}
 }
 
+func TestGetRandomPathWeighted(t *testing.T) {
+	lexer := NewJSGFLexer("\"")
+	table := []struct {
+		p    string
+		m    bool
+		want map[string]float64
+	}{
+		{p: "public <main> = a/1/|b/1/;", m: false, want: map[string]float64{"a": 0.5, "b": 0.5}},
+		{p: "public <main> = a/1/|b/2/|c/7/;", m: false, want: map[string]float64{"a": 0.1, "b": 0.2, "c": 0.7}},
+		{p: "public <main> = a/1/|b/2/|c/7/;", m: true, want: map[string]float64{"a": 0.1, "b": 0.2, "c": 0.7}},
+		{p: "public <main> = x(a/0.25/|b/0.75/);", m: true, want: map[string]float64{"xa": 0.25, "xb": 0.75}},
+		{p: "public <main> = <drink>;\n<drink> = tea/3/|coffee/1/;", m: false, want: map[string]float64{"tea": 0.75, "coffee": 0.25}},
+		{p: "public <main> = <drink>;\n<drink> = tea/3/|coffee/1/;", m: true, want: map[string]float64{"tea": 0.75, "coffee": 0.25}},
+		{p: "public <main> = <drink> [please/0/];\n<drink> = tea/3/|coffee/0/;", m: true, want: map[string]float64{"tea ": 1.0}},
+		{p: "public <main> = /10/ tea | /30/ coffee;", m: false, want: map[string]float64{" tea ": 0.25, " coffee": 0.75}},
+		{p: "public <main> = i want (/1/ <drink> | /3/ water);\n<drink> = /1/ tea|/1/ coffee;", m: false, want: map[string]float64{"i want   tea ": 0.125, "i want   coffee ": 0.125, "i want  water": 0.75}},
+		{p: "public <main> = i want (/1/ <drink> | /3/ water);\n<drink> = /1/ tea|/1/ coffee;", m: true, want: map[string]float64{"i want   tea ": 0.125, "i want   coffee ": 0.125, "i want  water": 0.75}},
+		{p: "public <main> = a <VOID> | b;", m: false, want: map[string]float64{" b": 1.0}},
+		{p: "public <main> = [x <VOID>] <NULL>y;", m: true, want: map[string]float64{" y": 1.0}},
+	}
+	for i, test := range table {
+		got := make(map[string]float64)
+		g, err := FomJSGF(NewGrammar(), bufio.NewScanner(strings.NewReader(test.p)), lexer)
+		if err == nil {
+			g, err = ResolveRules(g, lexer, 0)
+		}
+		if err != nil {
+			t.Errorf("test %v: getRandomPath(%v)\nGOT %v", i, test.p, err)
+			continue
+		}
+		graph := g.Rules["<main>"].Graph
+		if test.m {
+			graph = Minimize(graph, jsgfFilter)
+		}
+		for range 20000 {
+			path, err := getRandomPath(graph, 1)
+			if err != nil {
+				t.Errorf("test %v: getRandomPath(%v)\nGOT %v", i, test.p, err)
+				break
+			}
+			got[getSingleProduction(path, filterTokens(graph.Tokens, jsgfFilter), graphLoops{})] += 1 / 20000.0
+		}
+		for k, v := range got {
+			if math.Abs(v-test.want[k]) > 0.02 {
+				t.Errorf("test %v: getRandomPath(%v) frequency of %v\nGOT %v\nWANT %v", i, test.p, k, v, test.want[k])
+			}
+		}
+	}
+}
+
 func TestGraphDropNode(t *testing.T) {
 	table := []struct {
 		e    EdgeList
@@ -2105,6 +2158,34 @@ func TestGraphDropNode(t *testing.T) {
 				{From: 10, To: 11, Weight: 1.0},
 			},
 		},
+		{
+			e: EdgeList{
+				{From: 0, To: 1, Weight: 1.0},
+				{From: 1, To: 2, Weight: 0.5},
+				{From: 1, To: 3, Weight: 2.0},
+				{From: 2, To: 4, Weight: 1.0},
+				{From: 3, To: 4, Weight: 1.0},
+			},
+			i: 1,
+			want: EdgeList{
+				{From: 0, To: 2, Weight: 0.5},
+				{From: 0, To: 3, Weight: 2.0},
+				{From: 2, To: 4, Weight: 1.0},
+				{From: 3, To: 4, Weight: 1.0},
+			},
+		},
+		{
+			e: EdgeList{
+				{From: 0, To: 1, Weight: 3.0},
+				{From: 1, To: 2, Weight: 0.5},
+				{From: 2, To: 3, Weight: 1.0},
+			},
+			i: 1,
+			want: EdgeList{
+				{From: 0, To: 2, Weight: 1.5},
+				{From: 2, To: 3, Weight: 1.0},
+			},
+		},
 	}
 	for i, test := range table {
 		g := NewGraph(test.e,
@@ -2772,7 +2853,7 @@ func TestGetProductions(t *testing.T) {
 		},
 	}
 	for i, test := range table {
-		got := getProductions(test.r)
+		got := getProductions(test.r, 1)
 		sort.Strings(got)
 		sort.Strings(test.want)
 		if !slices.Equal(got, test.want) {
@@ -2950,3 +3031,90 @@ func TestFilterTokens(t *testing.T) {
 		}
 	}
 }
+
+func TestGetAllPathsRepeated(t *testing.T) {
+	table := []struct {
+		e    EdgeList
+		r    int
+		want []Path
+	}{
+		{
+			e:    EdgeList{{From: 0, To: 1, Weight: 1.0}, {From: 1, To: 1, Weight: 1.0}, {From: 1, To: 2, Weight: 1.0}},
+			r:    0,
+			want: []Path{},
+		},
+		{
+			e:    EdgeList{{From: 0, To: 1, Weight: 1.0}, {From: 1, To: 1, Weight: 1.0}, {From: 1, To: 2, Weight: 1.0}},
+			r:    1,
+			want: []Path{{0, 1, 2}},
+		},
+		{
+			e:    EdgeList{{From: 0, To: 1, Weight: 1.0}, {From: 1, To: 1, Weight: 1.0}, {From: 1, To: 2, Weight: 1.0}},
+			r:    3,
+			want: []Path{{0, 1, 2}, {0, 1, 1, 2}, {0, 1, 1, 1, 2}},
+		},
+		{
+			e: EdgeList{
+				{From: 0, To: 1, Weight: 1.0},
+				{From: 0, To: 3, Weight: 1.0},
+				{From: 1, To: 2, Weight: 1.0},
+				{From: 2, To: 1, Weight: 1.0},
+				{From: 2, To: 3, Weight: 1.0},
+			},
+			r:    2,
+			want: []Path{{0, 3}, {0, 1, 2, 3}, {0, 1, 2, 1, 2, 3}},
+		},
+	}
+	for i, test := range table {
+		g := NewGraph(test.e, []Expression{})
+		got := getAllPaths(g, test.r)
+		sort.Slice(got, func(i, j int) bool { return fmt.Sprint(got[i]) < fmt.Sprint(got[j]) })
+		sort.Slice(test.want, func(i, j int) bool { return fmt.Sprint(test.want[i]) < fmt.Sprint(test.want[j]) })
+		if len(got) != len(test.want) {
+			t.Errorf("test %v: GetAllPaths(%v, %v)\nGOT  %v\nWANT %v", i, test.e, test.r, got, test.want)
+			continue
+		}
+		for n := range got {
+			if !slices.Equal(got[n], test.want[n]) {
+				t.Errorf("test %v: GetAllPaths(%v, %v)\nGOT  %v\nWANT %v", i, test.e, test.r, got[n], test.want[n])
+			}
+		}
+	}
+}
+
+func TestGetLoopNodes(t *testing.T) {
+	table := []struct {
+		e    EdgeList
+		want []int
+	}{
+		{
+			e:    EdgeList{{From: 0, To: 1, Weight: 1.0}, {From: 1, To: 2, Weight: 1.0}},
+			want: []int{},
+		},
+		{
+			e:    EdgeList{{From: 0, To: 1, Weight: 1.0}, {From: 1, To: 1, Weight: 1.0}, {From: 1, To: 2, Weight: 1.0}},
+			want: []int{1},
+		},
+		{
+			e: EdgeList{
+				{From: 0, To: 1, Weight: 1.0},
+				{From: 1, To: 2, Weight: 1.0},
+				{From: 2, To: 3, Weight: 1.0},
+				{From: 3, To: 1, Weight: 1.0},
+				{From: 3, To: 4, Weight: 1.0},
+				{From: 4, To: 5, Weight: 1.0},
+			},
+			want: []int{1, 2, 3},
+		},
+	}
+	for i, test := range table {
+		var got []int
+		for k := range getLoopNodes(NewGraph(test.e, []Expression{})) {
+			got = append(got, k)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("test %v: getLoopNodes(%v)\nGOT  %v\nWANT %v", i, test.e, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+// -*- coding: utf-8 -*-
+
+// Created on Sat Oct 17 09:12:41 AM EDT 2026
+// author: Ryan Hildebrandt, github.com/ryancahildebrandt
+
+// Package gsgf produces natural language expressions from context free grammars in jsgf and jjsgf formats
+//
+// A grammar is loaded with one of the Load functions, resolved with Resolve, and then used to generate all productions, sample weighted productions, or export graph representations:
+//
+//	o := gsgf.NewOptions()
+//	g, err := gsgf.LoadFile("example.jsgf", o)
+//	...
+//	g, err = gsgf.Resolve(g, o)
+//	...
+//	productions := gsgf.Productions(g, o)
+//
+// For grammars with too many productions to hold in memory, StreamProductions yields them one at a time:
+//
+//	for prod := range gsgf.StreamProductions(g, o) {
+//		fmt.Println(prod)
+//	}
+package gsgf
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"maps"
+	"math/big"
+	mrand "math/rand/v2"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Settings used when reading, resolving, and producing expressions from a grammar
+type Options struct {
+	// Quote character surrounding literal strings in rule expressions. If empty, quotes are read as plain text
+	QuoteChar string
+	// Maximum number of times a token or group followed by * or + is repeated in a production, each time the production reaches it. Must be at least 1
+	MaxRepeat int
+	// Maximum number of levels recursive rule references are expanded to before being treated as <VOID>. If 0, recursive rules raise an error
+	MaxDepth int
+	// Minimize rule graphs before calculating paths and productions
+	Minimize bool
+	// Only allow public rules of imported grammars to be referenced from outside of their own grammar
+	StrictVisibility bool
+	// Report rules of the loaded grammar that shadow an imported rule, such as a local <size> and an imported <lib.size>, as errors rather than as warnings in Grammar.Warnings
+	StrictDuplicates bool
+	// Directories searched in order for imported grammars. If empty, the subdirectories of the loaded grammar's directory are searched
+	GrammarPath []string
+}
+
+// Returns options with the same defaults as the gsgf cli
+func NewOptions() Options {
+	return Options{QuoteChar: "\"", MaxRepeat: 3}
+}
+
+// Checks that the options can be used to resolve a grammar and produce expressions from it
+// Returns an error if o.MaxRepeat is less than 1
+func ValidateOptions(o Options) error {
+	if o.MaxRepeat < 1 {
+		return fmt.Errorf("error when calling ValidateOptions(), MaxRepeat %v:\n%+w", o.MaxRepeat, fmt.Errorf("%w, MaxRepeat must be at least 1", ErrInvalidOption))
+	}
+
+	return nil
+}
+
+// Reads a jsgf grammar from r, decoding it to UTF-8 from the charset declared in its header
+// Rules imported from other grammars are not resolved, see LoadFS
+func Load(r io.Reader, o Options) (Grammar, error) {
+	s, err := decodedScanner(r)
+	if err != nil {
+		return NewGrammar(), fmt.Errorf("in Load():\n%+w", err)
+	}
+	g, err := FomJSGF(NewGrammar(), s, NewJSGFLexer(o.QuoteChar))
+	if err != nil {
+		return g, fmt.Errorf("in Load():\n%+w", err)
+	}
+
+	return g, nil
+}
+
+// Reads a jjsgf grammar from r
+// Positions in errors and rules only include the file name, as lines and columns of the converted jsgf statements do not match the json source
+// Rules imported from other grammars are not resolved, see LoadFS
+func LoadJJSGF(r io.Reader, o Options) (Grammar, error) {
+	var jj JJSGFGrammarJSON
+
+	err := json.NewDecoder(r).Decode(&jj)
+	if err != nil {
+		return NewGrammar(), fmt.Errorf("in LoadJJSGF():\n%+w", fmt.Errorf("%w, %w", ErrInvalidJJSGF, err))
+	}
+
+	g, err := Load(strings.NewReader(JJSGFToJSGF(jj)), o)
+	if err != nil {
+		return updatePositions(g, fileOnly), updateErrorPosition(err, fileOnly)
+	}
+
+	return updatePositions(g, fileOnly), nil
+}
+
+// Reads a jsgf grammar from the string s
+// Rules imported from other grammars are not resolved, see LoadFS
+func LoadString(s string, o Options) (Grammar, error) {
+	return Load(strings.NewReader(s), o)
+}
+
+// Reads the grammar file at path p in fsys as jsgf or jjsgf, according to its extension
+// If the grammar references rules it does not define, they are imported from grammars found in the o.GrammarPath directories of fsys, or in the subdirectories of p's directory if none are given
+func LoadFS(fsys fs.FS, p string, o Options) (Grammar, error) {
+	var search []fs.FS
+
+	for _, d := range o.GrammarPath {
+		sub, err := fs.Sub(fsys, path.Clean(d))
+		if err != nil {
+			return NewGrammar(), fmt.Errorf("in LoadFS(%v):\n%+w", p, err)
+		}
+		search = append(search, rootedFS{FS: sub, root: path.Clean(d)})
+	}
+	g, err := loadFS(fsys, p, search, o)
+	if err != nil {
+		return g, fmt.Errorf("in LoadFS(%v):\n%+w", p, err)
+	}
+
+	return g, nil
+}
+
+// Reads the grammar file at path p on disk as jsgf or jjsgf, according to its extension
+// If the grammar references rules it does not define, they are imported from grammars found in the o.GrammarPath directories on disk, or in the subdirectories of p's directory if none are given
+func LoadFile(p string, o Options) (Grammar, error) {
+	var search []fs.FS
+
+	for _, d := range o.GrammarPath {
+		search = append(search, rootedFS{FS: os.DirFS(d), root: d})
+	}
+	g, err := loadFS(rootedFS{FS: os.DirFS(filepath.Dir(p)), root: filepath.Dir(p)}, filepath.Base(p), search, o)
+	if err != nil {
+		return g, fmt.Errorf("in LoadFile(%v):\n%+w", p, err)
+	}
+
+	return g, nil
+}
+
+// Helper function to read the grammar file at path p in fsys and import any rules it references from grammars in the search path
+// Positions of the grammar's rules and errors are set to the file's path, see filePath
+// If the file has invalid statements, rules are still imported for the valid ones, and the returned ErrorList also includes every reference in the file that cannot be resolved
+// Rules of the grammar that shadow an imported rule of the same name are added to the grammar's warnings, or returned as errors if o.StrictDuplicates is set
+func loadFS(fsys fs.FS, p string, search []fs.FS, o Options) (Grammar, error) {
+	var errs ErrorList
+
+	f, err := fsys.Open(path.Clean(p))
+	if err != nil {
+		return NewGrammar(), err
+	}
+	defer f.Close()
+	g, err := loadExt(f, path.Ext(p), o)
+	if err != nil && !errors.As(err, &errs) {
+		return g, updateErrorPosition(err, inFile(filePath(fsys, p)))
+	}
+	updateErrorPosition(errs, inFile(filePath(fsys, p)))
+	g = updatePositions(g, inFile(filePath(fsys, p)))
+	if ValidateGrammarCompleteness(g) == nil {
+		return g, errs.err()
+	}
+	local := slices.Sorted(maps.Keys(g.Rules))
+	namespace, src, err := createNameSpace(fsys, p, search, path.Ext(p), o.QuoteChar, o.StrictVisibility)
+	if err != nil && len(errs) == 0 {
+		return g, err
+	}
+	if err != nil {
+		errs.add(err, Position{}, "")
+		return g, errs.err()
+	}
+	g, err = importNameSpace(g, namespace, src, NewJSGFLexer(o.QuoteChar))
+	if err != nil {
+		errs.add(err, Position{}, "")
+		return g, errs.err()
+	}
+	errs = append(errs, undefinedReferences(g, local)...)
+	if o.StrictDuplicates {
+		errs = append(errs, duplicateRules(g, local)...)
+	} else {
+		g.Warnings = append(g.Warnings, duplicateRules(g, local)...)
+		g.Warnings.sort()
+	}
+
+	return g, errs.err()
+}
+
+// Helper function to read a grammar from r as jsgf or jjsgf according to the file extension e
+func loadExt(r io.Reader, e string, o Options) (Grammar, error) {
+	switch e {
+	case ".jsgf":
+		return Load(r, o)
+	case ".jjsgf":
+		return LoadJJSGF(r, o)
+	default:
+		return NewGrammar(), fmt.Errorf("error when calling loadExt(%v):\n%+w", e, ErrUnsupportedFormat)
+	}
+}
+
+// Resolves all rule references in g so that each rule's graph contains the graphs of the rules it references
+// - If o.Minimize is set, rule graphs are minimized before resolution and public rule graphs are minimized again after
+// Returns an error if the options are not valid, see ValidateOptions, a referenced rule is missing, or a recursive rule cannot be expanded within o.MaxDepth
+func Resolve(g Grammar, o Options) (Grammar, error) {
+	err := ValidateOptions(o)
+	if err != nil {
+		return g, fmt.Errorf("in Resolve(%v):\n%+w", g.Name, err)
+	}
+
+	if o.Minimize {
+		for k, v := range g.Rules {
+			v.Graph = Minimize(v.Graph, jsgfFilter)
+			g.Rules[k] = v
+		}
+	}
+	g, err = ResolveRules(g, NewJSGFLexer(o.QuoteChar), o.MaxDepth)
+	if err != nil {
+		return g, err
+	}
+	if o.Minimize {
+		for k, v := range g.Rules {
+			if v.IsPublic {
+				v.Graph = Minimize(v.Graph, jsgfFilter)
+				g.Rules[k] = v
+			}
+		}
+	}
+
+	return g, nil
+}
+
+// Returns all productions of the public rules in a resolved grammar, disregarding token weights
+func Productions(g Grammar, o Options) []string {
+	return GetAllProductions(g, o.MaxRepeat)
+}
+
+// Yields the productions of the public rules in a resolved grammar one at a time, disregarding token weights
+// Breaking out of the loop stops generation, so taking the first n productions does not generate the rest
+func StreamProductions(g Grammar, o Options) iter.Seq[string] {
+	return AllProductions(g, o.MaxRepeat)
+}
+
+// Returns the number of productions of the public rules in a resolved grammar without generating them
+// The count matches the number of productions returned by Productions for the same options, and does not overflow for grammars with too many productions to generate
+func CountProductions(g Grammar, o Options) *big.Int {
+	return countAllProductions(g, o.MaxRepeat)
+}
+
+// Returns the number of productions of each public rule in a resolved grammar and of each rule they reference, keyed by rule name
+func CountRuleProductions(g Grammar, o Options) map[string]*big.Int {
+	return countRuleProductions(g, o.MaxRepeat)
+}
+
+// Yields the productions of the public rules in a resolved grammar in the same order as StreamProductions, starting from the production at index i
+// The productions before index i are not generated, so productions can be paged through or a run resumed from where it stopped
+func StreamProductionsFrom(g Grammar, i *big.Int, o Options) iter.Seq[string] {
+	return productionsFrom(g, o.MaxRepeat, i)
+}
+
+// Returns the production at index i of a rule in a resolved grammar, in the order StreamProductions yields the rule's productions, without generating the productions before it
+// Returns an error if the rule is not defined or i is not less than the rule's number of productions
+func ProductionAt(g Grammar, rule string, i *big.Int, o Options) (string, error) {
+	r, ok := g.Rules[rule]
+	if !ok {
+		return "", fmt.Errorf("error when calling ProductionAt(%v, %v):\n%+w", rule, i, ErrUndefinedRule)
+	}
+	c := newProductionCounter(r, o.MaxRepeat)
+	path, _, ok := c.seek(i)
+	if !ok {
+		return "", fmt.Errorf("error when calling ProductionAt(%v, %v):\n%+w", rule, i, ErrIndexOutOfRange)
+	}
+
+	return getSingleProduction(path, c.tokens, c.all.loops), nil
+}
+
+// Returns the index of production p among the productions of a rule in a resolved grammar, such that ProductionAt returns p for the index
+// If the rule produces p more than once, the first index is returned
+// Returns an error if the rule is not defined or does not produce p
+func IndexOf(g Grammar, rule string, p string, o Options) (*big.Int, error) {
+	r, ok := g.Rules[rule]
+	if !ok {
+		return new(big.Int), fmt.Errorf("error when calling IndexOf(%v, %q):\n%+w", rule, p, ErrUndefinedRule)
+	}
+	i, ok := newProductionCounter(r, o.MaxRepeat).index(p)
+	if !ok {
+		return new(big.Int), fmt.Errorf("error when calling IndexOf(%v, %q):\n%+w", rule, p, ErrProductionNotFound)
+	}
+
+	return i, nil
+}
+
+// Returns n productions from randomly chosen public rules in a resolved grammar, according to token weights
+// Returns an error if the grammar has no public rules or a path cannot be sampled from a rule's graph
+func Sample(g Grammar, n int, o Options) ([]string, error) {
+	var (
+		keys []string
+		res  []string
+	)
+
+	for k, v := range g.Rules {
+		if v.IsPublic {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return res, fmt.Errorf("error when calling Sample(%v, %v):\n%+w", g.Name, n, ErrNoPublicRules)
+	}
+	slices.Sort(keys)
+	for len(res) < n {
+		k := keys[mrand.IntN(len(keys))]
+		rule := g.Rules[k]
+		path, err := getRandomPath(rule.Graph, o.MaxRepeat)
+		if err != nil {
+			return res, fmt.Errorf("in Sample(%v, %v):\n%+w", g.Name, n, &SourceError{Pos: rule.pos, Msg: "cannot sample a production from rule", Text: k, Err: err})
+		}
+		loops := getLoops(rule.Graph, isLive(getLiveNodes(rule.Graph)))
+		res = append(res, getSingleProduction(path, filterTokens(rule.Graph.Tokens, jsgfFilter), loops))
+	}
+
+	return res, nil
+}
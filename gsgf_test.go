@@ -0,0 +1,474 @@
+// -*- coding: utf-8 -*-
+
+// Created on Sat Oct 17 09:12:44 AM EDT 2026
+// author: Ryan Hildebrandt, github.com/ryancahildebrandt
+
+package gsgf
+
+import (
+	"bufio"
+	"embed"
+	"errors"
+	"io/fs"
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+//go:embed data/tests
+var testGrammars embed.FS
+
+func TestLoadString(t *testing.T) {
+	table := []struct {
+		s       string
+		q       string
+		want    []string
+		wantErr bool
+	}{
+		{s: "", q: "\"", want: []string{}, wantErr: false},
+		{s: "grammar a;\npublic <main> = a | b;", q: "\"", want: []string{"<main>"}, wantErr: false},
+		{s: "grammar a;\npublic <main> = a | <b>;\n<b> = c;", q: "\"", want: []string{"<b>", "<main>"}, wantErr: false},
+		{s: "grammar a;\npublic <main> = 'a;b';", q: "'", want: []string{"<main>"}, wantErr: false},
+		{s: "grammar a;\npublic <main> = a | b", q: "\"", want: []string{}, wantErr: true},
+		{s: "#JSGF 1.0;\npublic <main> = a | b;", q: "\"", want: []string{"<main>"}, wantErr: true},
+		{s: "grammar a;\npublic <main> = a | <b>;\n<b> c;\n<c> = d;", q: "\"", want: []string{"<c>", "<main>"}, wantErr: true},
+		{s: "grammar a;\npublic <main> = a;\n<main> = b;\n<c> = /1/ d | /1.2.3/ e;", q: "\"", want: []string{"<main>"}, wantErr: true},
+	}
+	for i, test := range table {
+		o := NewOptions()
+		o.QuoteChar = test.q
+		g, err := LoadString(test.s, o)
+		var got []string
+		for k := range g.Rules {
+			got = append(got, k)
+		}
+		sort.Strings(got)
+		if !slices.Equal(got, test.want) && len(got)+len(test.want) > 0 {
+			t.Errorf("test %v: LoadString(%v).Rules\nGOT %v\nWANT %v", i, test.s, got, test.want)
+		}
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: LoadString(%v).err\nGOT %v\nWANT %v", i, test.s, err, test.wantErr)
+		}
+	}
+}
+
+func TestLoadFS(t *testing.T) {
+	var productions []string
+	f, err := os.Open("data/tests/productions.txt")
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		productions = append(productions, scanner.Text())
+	}
+	mapFS := fstest.MapFS{
+		"a.jsgf":         {Data: []byte("grammar a;\npublic <main> = a | b;")},
+		"b.jjsgf":        {Data: []byte(`{"grammar": "b", "public": {"main": "a | b"}}`)},
+		"c.txt":          {Data: []byte("grammar c;\npublic <main> = a | b;")},
+		"dir/d.jsgf":     {Data: []byte("grammar d;\npublic <main> = a | <e>;\n<e> = b;")},
+		"f/latin.jsgf":   {Data: []byte("#JSGF V1.0 ISO8859-1 fr;\ngrammar f;\npublic <main> = th\xE9;")},
+		"g.jsgf":         {Data: []byte("grammar g;\nimport <lib.drink>;\npublic <main> = i'd like <drink>;")},
+		"lib/lib.jsgf":   {Data: []byte("grammar lib;\npublic <drink> = <teatype> tea;\n<teatype> = green | black;")},
+		"h.jjsgf":        {Data: []byte(`{"grammar": "h", "imports": ["jlib.*"], "public": {"main": "a <size>"}}`)},
+		"lib/jlib.jjsgf": {Data: []byte(`{"grammar": "jlib", "public": {"size": "small | large"}}`)},
+		"i.jsgf":         {Data: []byte("grammar i;\nimport <dne.*>;\npublic <main> = <dne>;")},
+	}
+	table := []struct {
+		fsys    fs.FS
+		p       string
+		path    []string
+		want    []string
+		wantErr bool
+	}{
+		{fsys: mapFS, p: "a.jsgf", want: []string{"a ", " b"}, wantErr: false},
+		{fsys: mapFS, p: "b.jjsgf", want: []string{"a ", " b"}, wantErr: false},
+		{fsys: mapFS, p: "c.txt", want: []string{}, wantErr: true},
+		{fsys: mapFS, p: "dir/d.jsgf", want: []string{"a ", " b"}, wantErr: false},
+		{fsys: fstest.MapFS{"e.jjsgf": {Data: []byte("grammar e;")}}, p: "e.jjsgf", want: []string{}, wantErr: true},
+		{fsys: mapFS, p: "f/latin.jsgf", want: []string{"thé"}, wantErr: false},
+		{fsys: mapFS, p: "g.jsgf", want: []string{"i'd like green  tea", "i'd like  black tea"}, wantErr: false},
+		{fsys: mapFS, p: "h.jjsgf", want: []string{"a small ", "a  large"}, wantErr: false},
+		{fsys: mapFS, p: "i.jsgf", want: []string{}, wantErr: true},
+		{fsys: mapFS, p: "missing.jsgf", want: []string{}, wantErr: true},
+		{fsys: testGrammars, p: "data/tests/test0.jsgf", want: productions, wantErr: false},
+		{fsys: testGrammars, p: "data/tests/test1.jjsgf", want: productions, wantErr: false},
+		{fsys: testGrammars, p: "data/tests/test10.jsgf", want: []string{}, wantErr: true},
+		{fsys: testGrammars, p: "data/tests/searchpath/app/main.jsgf", path: []string{"data/tests/searchpath/lib", "data/tests/searchpath/shared"}, want: []string{"green tea  with milk ", "green tea   with lemon", " black tea with milk ", " black tea  with lemon"}, wantErr: false},
+		{fsys: testGrammars, p: "data/tests/searchpath/app/main.jsgf", path: []string{"./data/tests/searchpath/shared"}, want: []string{"coffee with milk ", "coffee  with lemon"}, wantErr: false},
+		{fsys: testGrammars, p: "data/tests/searchpath/app/main.jsgf", path: []string{"../data"}, want: []string{}, wantErr: true},
+		{fsys: testGrammars, p: "data/tests/searchpath/app/main.jsgf", want: []string{}, wantErr: true},
+	}
+	for i, test := range table {
+		var got []string
+		o := NewOptions()
+		o.GrammarPath = test.path
+		g, err := LoadFS(test.fsys, test.p, o)
+		if err == nil {
+			g, err = Resolve(g, o)
+			got = Productions(g, o)
+		}
+		sort.Strings(got)
+		sort.Strings(test.want)
+		if !slices.Equal(got, test.want) && err == nil {
+			t.Errorf("test %v: LoadFS(%v).Productions()\nGOT %q\nWANT %q", i, test.p, got, test.want)
+		}
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: LoadFS(%v).err\nGOT %v\nWANT %v", i, test.p, err, test.wantErr)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	var productions []string
+	f, err := os.Open("data/tests/productions.txt")
+	if err != nil {
+		t.Errorf("%s", err)
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		productions = append(productions, scanner.Text())
+	}
+	table := []struct {
+		p        string
+		minimize bool
+		path     []string
+		want     []string
+		wantErr  bool
+	}{
+		{p: "data/tests/test0.jsgf", minimize: false, want: productions, wantErr: false},
+		{p: "data/tests/test0.jsgf", minimize: true, want: productions, wantErr: false},
+		{p: "data/tests/test7.jsgf", minimize: false, want: productions, wantErr: false},
+		{p: "data/tests/test0.jjsgf", minimize: false, want: productions, wantErr: false},
+		{p: "data/tests/test1.jjsgf", minimize: false, want: productions, wantErr: false},
+		{p: "data/tests/test10.jsgf", minimize: false, want: []string{}, wantErr: true},
+		{p: "data/tests/productions.txt", minimize: false, want: []string{}, wantErr: true},
+		{p: "data/tests/missing.jsgf", minimize: false, want: []string{}, wantErr: true},
+		{p: "data/tests/searchpath/app/main.jsgf", minimize: false, path: []string{"data/tests/searchpath/lib", "data/tests/searchpath/shared"}, want: []string{"green tea  with milk ", "green tea   with lemon", " black tea with milk ", " black tea  with lemon"}, wantErr: false},
+		{p: "data/tests/searchpath/app/main.jsgf", minimize: false, path: []string{"data/tests/searchpath/shared", "data/tests/searchpath/lib"}, want: []string{"coffee with milk ", "coffee  with lemon"}, wantErr: false},
+		{p: "data/tests/searchpath/app/main.jsgf", minimize: false, path: []string{"data/tests/searchpath/lib"}, want: []string{}, wantErr: true},
+		{p: "data/tests/searchpath/app/main.jsgf", minimize: false, path: []string{"data/tests/searchpath/dne"}, want: []string{}, wantErr: true},
+		{p: "data/tests/test0.jsgf", minimize: false, path: []string{"data/tests"}, want: productions, wantErr: false},
+		{p: "data/tests/packages/bare.jsgf", minimize: false, want: []string{"green  tea", " black tea"}, wantErr: false},
+		{p: "data/tests/packages/app.jsgf", minimize: true, want: []string{"small  green  tea ", " large green  tea ", "small   black tea ", " large  black tea ", "small  green  tea please", " large green  tea please", "small   black tea please", " large  black tea please"}, wantErr: false},
+	}
+	for i, test := range table {
+		var got []string
+		o := NewOptions()
+		o.MaxRepeat = 1
+		o.Minimize = test.minimize
+		o.GrammarPath = test.path
+		g, err := LoadFile(test.p, o)
+		if err == nil {
+			g, err = Resolve(g, o)
+			got = Productions(g, o)
+		}
+		sort.Strings(got)
+		sort.Strings(test.want)
+		if !slices.Equal(got, test.want) && err == nil {
+			t.Errorf("test %v: LoadFile(%v).Productions()\nGOT %v\nWANT %v", i, test.p, got, test.want)
+		}
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: LoadFile(%v).err\nGOT %v\nWANT %v", i, test.p, err, test.wantErr)
+		}
+	}
+}
+
+func TestLoadErrorPositions(t *testing.T) {
+	mapFS := fstest.MapFS{
+		"undefined.jsgf": {Data: []byte("grammar tea;\n\npublic <main> = i want\n    <size> <quant> tea;\n<size> = small | large;")},
+		"invalid.jsgf":   {Data: []byte("grammar a;\n<a> = b;\n<b> c;")},
+		"header.jsgf":    {Data: []byte("#JSGF 1.0;\ngrammar a;")},
+		"comment.jsgf":   {Data: []byte("grammar a;\npublic <a> = b; /* open")},
+		"weight.jsgf":    {Data: []byte("grammar a;\npublic <a> = /1/ b | /1.2.3/ c;")},
+		"partial.jsgf":   {Data: []byte("grammar a;\npublic <a> = /1/ b | c;")},
+		"cycle.jsgf":     {Data: []byte("grammar a;\npublic <a> = x <b>;\n<b> = y <a>;")},
+		"group.jsgf":     {Data: []byte("grammar a;\npublic <a> = x (y | z;")},
+		"json.jjsgf":     {Data: []byte(`{"grammar": "j", "public": {"main": "a <b>"}}`)},
+		"junk.jsgf":      {Data: []byte("grammar a;\npublic <a> = b;\n  this is junk;")},
+		"quote.jsgf":     {Data: []byte("grammar a;\npublic <a> = say \"b | c;\npublic <d> = e;")},
+	}
+	importFS := fstest.MapFS{
+		"missing.jsgf":   {Data: []byte("grammar a;\nimport <dne.*>;\npublic <a> = <dne>;")},
+		"import.jsgf":    {Data: []byte("grammar a;\nimport <lib.*>;\npublic <a> = <drink>;")},
+		"private.jsgf":   {Data: []byte("grammar a;\nimport <lib.*>;\npublic <a> = x <lib.secret>;")},
+		"junklib.jsgf":   {Data: []byte("grammar a;\nimport <junk.*>;\npublic <a> = <b>;")},
+		"junk/junk.jsgf": {Data: []byte("grammar junk;\npublic <b> = c;\nnot a rule;")},
+		"lib/lib.jsgf":   {Data: []byte("grammar lib;\n<secret> = s;\npublic <drink> = <teatype>\n  tea <sugar>;\n<teatype> = green;")},
+	}
+	table := []struct {
+		fsys   fs.FS
+		p      string
+		strict bool
+		want   string
+		is     error
+	}{
+		{fsys: mapFS, p: "undefined.jsgf", want: "undefined.jsgf:4:12: undefined rule <quant>", is: ErrUndefinedRule},
+		{fsys: mapFS, p: "invalid.jsgf", want: "invalid.jsgf:3:1: invalid jsgf rule <b> c;", is: ErrInvalidRule},
+		{fsys: mapFS, p: "header.jsgf", want: "header.jsgf:1:1: invalid jsgf header #JSGF 1.0;", is: ErrInvalidHeader},
+		{fsys: mapFS, p: "comment.jsgf", want: "comment.jsgf:2:17: block comment is not closed /*", is: ErrUnclosedComment},
+		{fsys: mapFS, p: "weight.jsgf", want: "weight.jsgf:2:22: invalid weight /1.2.3/", is: ErrInvalidWeight},
+		{fsys: mapFS, p: "partial.jsgf", want: "partial.jsgf:2:8: weights must be provided for all alternatives in a group or none of them", is: ErrInvalidWeight},
+		{fsys: mapFS, p: "group.jsgf", want: "group.jsgf:2:16: unclosed group (", is: ErrInvalidRule},
+		{fsys: mapFS, p: "cycle.jsgf", want: "cycle.jsgf:3:9: cyclic rule reference <a> -> <b> -> <a>", is: ErrCyclicReference},
+		{fsys: importFS, p: "missing.jsgf", want: "missing.jsgf:2:9: grammar not found dne, import chain a -> dne", is: ErrGrammarNotFound},
+		{fsys: importFS, p: "import.jsgf", want: "lib/lib.jsgf:4:7: undefined rule <sugar>", is: ErrUndefinedRule},
+		{fsys: importFS, p: "private.jsgf", strict: true, want: "private.jsgf:3:16: private rule referenced outside of its grammar <lib.secret>", is: ErrPrivateRule},
+		{fsys: mapFS, p: "json.jjsgf", want: "json.jjsgf: undefined rule <b>", is: ErrUndefinedRule},
+		{fsys: mapFS, p: "quote.jsgf", want: "quote.jsgf:2:18: unclosed literal \"", is: ErrInvalidRule},
+		{fsys: mapFS, p: "junk.jsgf", want: "junk.jsgf:3:3: invalid jsgf statement, not a header, name declaration, import, or rule this is junk;", is: ErrInvalidStatement},
+		{fsys: importFS, p: "junklib.jsgf", want: "junk/junk.jsgf:3:1: invalid jsgf statement, not a header, name declaration, import, or rule not a rule;", is: ErrInvalidStatement},
+	}
+	for i, test := range table {
+		var se *SourceError
+
+		o := NewOptions()
+		o.StrictVisibility = test.strict
+		g, err := LoadFS(test.fsys, test.p, o)
+		if err == nil {
+			_, err = Resolve(g, o)
+		}
+		if !errors.As(err, &se) {
+			t.Errorf("test %v: LoadFS(%v).err\nGOT %v\nWANT %v", i, test.p, err, test.want)
+			continue
+		}
+		if se.Error() != test.want {
+			t.Errorf("test %v: LoadFS(%v).err\nGOT %v\nWANT %v", i, test.p, se.Error(), test.want)
+		}
+		if !errors.Is(err, test.is) {
+			t.Errorf("test %v: errors.Is(LoadFS(%v).err, %v)\nGOT false\nWANT true", i, test.p, test.is)
+		}
+	}
+}
+
+func TestLoadErrorList(t *testing.T) {
+	mapFS := fstest.MapFS{
+		"menu.jsgf":  {Data: []byte("grammar menu;\npublic <order> = <size> <drink> <milk> <sugar>;\n<size> small | large;\n<drink> = /2/ tea | /1.2.3/ coffee;\n<sugar> = sugar;\n<sugar> = honey;")},
+		"valid.jsgf": {Data: []byte("grammar menu;\npublic <order> = tea;")},
+	}
+	table := []struct {
+		p     string
+		want  []string
+		rules []string
+		is    []error
+	}{
+		{p: "valid.jsgf", want: []string{}, rules: []string{"<order>"}},
+		{
+			p: "menu.jsgf",
+			want: []string{
+				"menu.jsgf:2:33: undefined rule <milk>",
+				"menu.jsgf:3:1: invalid jsgf rule <size> small | large;",
+				"menu.jsgf:4:21: invalid weight /1.2.3/",
+				"menu.jsgf:6:1: duplicate rule definition <sugar> (previously defined at menu.jsgf:5:1)",
+			},
+			rules: []string{"<order>", "<sugar>"},
+			is:    []error{ErrUndefinedRule, ErrInvalidRule, ErrInvalidWeight, ErrDuplicateRule},
+		},
+	}
+	for i, test := range table {
+		var (
+			errs ErrorList
+			got  []string
+		)
+
+		g, err := LoadFS(mapFS, test.p, NewOptions())
+		if err != nil && !errors.As(err, &errs) {
+			t.Errorf("test %v: LoadFS(%v).err\nGOT %v\nWANT ErrorList", i, test.p, err)
+			continue
+		}
+		for _, e := range errs {
+			got = append(got, e.Error())
+		}
+		if !slices.Equal(got, test.want) && len(got)+len(test.want) > 0 {
+			t.Errorf("test %v: LoadFS(%v).err\nGOT %v\nWANT %v", i, test.p, got, test.want)
+		}
+		for _, e := range test.is {
+			if !errors.Is(err, e) {
+				t.Errorf("test %v: errors.Is(LoadFS(%v).err, %v)\nGOT false\nWANT true", i, test.p, e)
+			}
+		}
+		if !slices.Equal(slices.Sorted(maps.Keys(g.Rules)), test.rules) {
+			t.Errorf("test %v: LoadFS(%v).Rules\nGOT %v\nWANT %v", i, test.p, slices.Sorted(maps.Keys(g.Rules)), test.rules)
+		}
+	}
+}
+
+func TestLoadDuplicateRules(t *testing.T) {
+	mapFS := fstest.MapFS{
+		"local.jsgf":    {Data: []byte("grammar a;\nimport <lib.*>;\npublic <a> = <drink> <size>;\n<size> = small;")},
+		"shared.jsgf":   {Data: []byte("grammar a;\nimport <lib.*>;\nimport <other.*>;\npublic <a> = <lib.drink> <other.drink>;")},
+		"broken.jsgf":   {Data: []byte("grammar a;\nimport <dup.*>;\npublic <a> = <x>;")},
+		"self.jsgf":     {Data: []byte("grammar self;\nimport <self.*>;\nimport <lib.*>;\npublic <a> = <x> <size>;\n<x> = one;")},
+		"pkg/main.jsgf": {Data: []byte("grammar lib;\nimport <lib.*>;\npublic <a> = <drink> <size>;\n<drink> = coffee;")},
+		"pkg/lib.jsgf":  {Data: []byte("grammar lib;\npublic <drink> = tea;\npublic <size> = large;")},
+		"lib/lib.jsgf":  {Data: []byte("grammar lib;\npublic <drink> = tea;\npublic <size> = large;")},
+		"other/o.jsgf":  {Data: []byte("grammar other;\npublic <drink> = coffee;")},
+		"dup/dup.jsgf":  {Data: []byte("grammar dup;\npublic <x> = a;\n<y> = b;\npublic <x> = c;")},
+	}
+	table := []struct {
+		p        string
+		strict   bool
+		warnings []string
+		errs     []string
+	}{
+		{p: "local.jsgf", strict: false, warnings: []string{"lib/lib.jsgf:3:8: duplicate rule definition <lib.size> (previously defined at local.jsgf:4:1)"}, errs: []string{}},
+		{p: "local.jsgf", strict: true, warnings: []string{}, errs: []string{"lib/lib.jsgf:3:8: duplicate rule definition <lib.size> (previously defined at local.jsgf:4:1)"}},
+		{p: "shared.jsgf", strict: false, warnings: []string{}, errs: []string{}},
+		{p: "self.jsgf", strict: true, warnings: []string{}, errs: []string{}},
+		{p: "pkg/main.jsgf", strict: false, warnings: []string{"pkg/lib.jsgf:2:8: duplicate rule definition <lib.drink> (previously defined at pkg/main.jsgf:4:1)"}, errs: []string{}},
+		{p: "pkg/main.jsgf", strict: true, warnings: []string{}, errs: []string{"pkg/lib.jsgf:2:8: duplicate rule definition <lib.drink> (previously defined at pkg/main.jsgf:4:1)"}},
+		{p: "broken.jsgf", strict: false, warnings: []string{}, errs: []string{"dup/dup.jsgf:4:8: duplicate rule definition <x> (previously defined at dup/dup.jsgf:2:8)"}},
+	}
+	for i, test := range table {
+		var (
+			errs     ErrorList
+			warnings []string
+			got      []string
+		)
+
+		o := NewOptions()
+		o.StrictDuplicates = test.strict
+		g, err := LoadFS(mapFS, test.p, o)
+		if err != nil && !errors.As(err, &errs) {
+			t.Errorf("test %v: LoadFS(%v).err\nGOT %v\nWANT ErrorList", i, test.p, err)
+			continue
+		}
+		for _, e := range errs {
+			got = append(got, e.Error())
+		}
+		for _, w := range g.Warnings {
+			warnings = append(warnings, w.Error())
+		}
+		if !slices.Equal(got, test.errs) && len(got)+len(test.errs) > 0 {
+			t.Errorf("test %v: LoadFS(%v).err\nGOT %v\nWANT %v", i, test.p, got, test.errs)
+		}
+		if !slices.Equal(warnings, test.warnings) && len(warnings)+len(test.warnings) > 0 {
+			t.Errorf("test %v: LoadFS(%v).Warnings\nGOT %v\nWANT %v", i, test.p, warnings, test.warnings)
+		}
+		if len(test.errs) > 0 && !errors.Is(err, ErrDuplicateRule) {
+			t.Errorf("test %v: errors.Is(LoadFS(%v).err, ErrDuplicateRule)\nGOT false\nWANT true", i, test.p)
+		}
+	}
+}
+
+func TestResolveOptions(t *testing.T) {
+	table := []struct {
+		r       int
+		wantErr bool
+	}{
+		{r: -1, wantErr: true},
+		{r: 0, wantErr: true},
+		{r: 1, wantErr: false},
+		{r: 2, wantErr: false},
+	}
+	for i, test := range table {
+		o := NewOptions()
+		o.MaxRepeat = test.r
+		g, err := LoadString("grammar a;\npublic <a> = b+;", o)
+		if err != nil {
+			t.Errorf("test %v: LoadString().err\nGOT %v\nWANT nil", i, err)
+			continue
+		}
+		_, err = Resolve(g, o)
+		if (err != nil) != test.wantErr || (err != nil && !errors.Is(err, ErrInvalidOption)) {
+			t.Errorf("test %v: Resolve(), MaxRepeat %v\nGOT %v\nWANT %v", i, test.r, err, test.wantErr)
+		}
+	}
+}
+
+func TestStreamProductions(t *testing.T) {
+	table := []struct {
+		s    string
+		n    int
+		want []string
+	}{
+		{s: "grammar a;\npublic <b> = x | y;\npublic <a> = (one | two) [three];", n: -1, want: []string{"one", "one three", "two", "two three", "x", "y"}},
+		{s: "grammar a;\npublic <b> = x | y;\npublic <a> = (one | two) [three];", n: 3, want: []string{"one", "one three", "two", "two three"}},
+		{s: "grammar a;\npublic <a> = <c> <c> <c> <c> <c> <c> <c> <c>;\n<c> = 0 | 1 | 2 | 3 | 4 | 5 | 6 | 7 | 8 | 9;", n: 2, want: []string{}},
+		{s: "grammar a;\n<a> = x;", n: -1, want: []string{}},
+	}
+	for i, test := range table {
+		var got []string
+
+		o := NewOptions()
+		g, err := LoadString(test.s, o)
+		if err != nil {
+			t.Errorf("test %v: LoadString(%v).err\nGOT %v\nWANT nil", i, test.s, err)
+			continue
+		}
+		g, err = Resolve(g, o)
+		if err != nil {
+			t.Errorf("test %v: Resolve(%v).err\nGOT %v\nWANT nil", i, test.s, err)
+			continue
+		}
+		for prod := range StreamProductions(g, o) {
+			if len(got) == test.n {
+				break
+			}
+			got = append(got, prod)
+		}
+		got = RemoveEndSpaces(RemoveMultipleSpaces(got))
+		switch {
+		case test.n == -1:
+			sort.Strings(got)
+			if !slices.Equal(got, test.want) && len(got)+len(test.want) > 0 {
+				t.Errorf("test %v: StreamProductions(%v)\nGOT %q\nWANT %q", i, test.s, got, test.want)
+			}
+		case len(got) != test.n:
+			t.Errorf("test %v: StreamProductions(%v) stopped after %v\nGOT %v\nWANT %v", i, test.s, test.n, len(got), test.n)
+		}
+		for _, prod := range got {
+			if len(test.want) > 0 && !slices.Contains(test.want, prod) {
+				t.Errorf("test %v: StreamProductions(%v)\nGOT %q\nWANT one of %q", i, test.s, prod, test.want)
+			}
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	table := []struct {
+		s       string
+		n       int
+		want    []string
+		wantErr bool
+		wantMsg string
+	}{
+		{s: "grammar a;\npublic <main> = a | b;", n: 0, want: []string{}, wantErr: false},
+		{s: "grammar a;\npublic <main> = a | b;", n: 10, want: []string{"a", "b"}, wantErr: false},
+		{s: "grammar a;\npublic <main> = /1/ a | /0/ b;", n: 10, want: []string{"a"}, wantErr: false},
+		{s: "grammar a;\npublic <main> = a;\npublic <other> = b;", n: 50, want: []string{"a", "b"}, wantErr: false},
+		{s: "grammar a;\n<main> = a | b;", n: 1, want: []string{}, wantErr: true},
+		{s: "grammar a;\npublic <main> = <VOID>;", n: 1, want: []string{}, wantErr: true, wantMsg: "2:8: cannot sample a production from rule <main>"},
+	}
+	for i, test := range table {
+		o := NewOptions()
+		g, err := LoadString(test.s, o)
+		if err != nil {
+			t.Errorf("test %v: LoadString(%v)\nGOT %v", i, test.s, err)
+		}
+		g, err = Resolve(g, o)
+		if err != nil {
+			t.Errorf("test %v: Resolve(%v)\nGOT %v", i, test.s, err)
+		}
+		got, err := Sample(g, test.n, o)
+		if len(got) != test.n && !test.wantErr {
+			t.Errorf("test %v: len(Sample(%v, %v))\nGOT %v\nWANT %v", i, test.s, test.n, len(got), test.n)
+		}
+		for _, p := range got {
+			if !slices.Contains(test.want, strings.TrimSpace(p)) {
+				t.Errorf("test %v: Sample(%v, %v)\nGOT %v\nWANT one of %v", i, test.s, test.n, p, test.want)
+			}
+		}
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: Sample(%v, %v).err\nGOT %v\nWANT %v", i, test.s, test.n, err, test.wantErr)
+		}
+		var se *SourceError
+		if test.wantMsg != "" && (!errors.As(err, &se) || se.Error() != test.wantMsg) {
+			t.Errorf("test %v: Sample(%v, %v).err\nGOT %v\nWANT %v", i, test.s, test.n, err, test.wantMsg)
+		}
+	}
+}
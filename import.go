@@ -3,18 +3,23 @@
 // Created on Sat Feb 15 05:19:18 PM EST 2025
 // author: Ryan Hildebrandt, github.com/ryancahildebrandt
 
-package main
+package gsgf
 
 import (
 	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"io/fs"
+	"maps"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+
+	"github.com/bzick/tokenizer"
 )
 
 // Returns the gram.rule portion of a jsgf import statement
@@ -39,6 +44,18 @@ func cleanGrammarStatement(s string) string {
 	return s
 }
 
+// Returns the version, charset, and locale from a jsgf header, where charset and locale are optional
+func cleanHeaderStatement(s string) (string, string, string) {
+	var fields []string
+
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "#JSGF")
+	s = strings.TrimSuffix(s, ";")
+	fields = append(strings.Fields(s), "", "", "")
+
+	return fields[0], fields[1], fields[2]
+}
+
 // Checks that the string is a valid jsgf rule containing:
 // - optional public declaration
 // - the name of the rule being defined, in <>
@@ -47,7 +64,20 @@ func cleanGrammarStatement(s string) string {
 // - a closing semi-colon ;
 func ValidateJSGFRule(s string) error {
 	if !regexp.MustCompile("^(public )?<.+?> ?= ?.*?;$").MatchString(s) {
-		return fmt.Errorf("error when calling ValidateJSGFRule(%v):\n%+w", s, errors.New("invalid jsgf line"))
+		return fmt.Errorf("error when calling ValidateJSGFRule(%v):\n%+w", s, ErrInvalidRule)
+	}
+
+	return nil
+}
+
+// Checks that the string is a valid jsgf header, containing:
+// - #JSGF
+// - a version, such as V1.0
+// - optional charset and locale
+// - a closing semicolon ;
+func ValidateJSGFHeader(s string) error {
+	if !regexp.MustCompile(`^#JSGF V[0-9]+\.[0-9]+( [^ ;]+){0,2};$`).MatchString(s) {
+		return fmt.Errorf("error when calling ValidateJSGFHeader(%v):\n%+w", s, ErrInvalidHeader)
 	}
 
 	return nil
@@ -59,7 +89,7 @@ func ValidateJSGFRule(s string) error {
 // - a closing semicolon ;
 func ValidateJSGFName(s string) error {
 	if !regexp.MustCompile("^grammar .+?;$").MatchString(s) {
-		return fmt.Errorf("error when calling ValidateJSGFName(%v):\n%+w", s, errors.New("invalid jsgf name declaration"))
+		return fmt.Errorf("error when calling ValidateJSGFName(%v):\n%+w", s, ErrInvalidName)
 	}
 
 	return nil
@@ -73,171 +103,575 @@ func ValidateJSGFName(s string) error {
 // - a closing semicolon ;
 func ValidateJSGFImport(s string) error {
 	if !regexp.MustCompile("^import <.+?>;$").MatchString(s) {
-		return fmt.Errorf("error when calling ValidateJSGFImport(%v):\n%+w", s, errors.New("invalid jsgf import"))
+		return fmt.Errorf("error when calling ValidateJSGFImport(%v):\n%+w", s, ErrInvalidImport)
 	}
 
 	return nil
 }
 
 // Collects all required rules from grammar files in subdirectories of the provided path
-// - Reads import order from the root grammar
-// - For each imported grammar, reads each import statement and rule
+// - Reads the grammar at path p from the local filesystem, with double quoted literals and no strict visibility checks, see CreateNameSpaceFS
 // Returns an error if the required grammars cannot be found or opened
 func CreateNameSpace(p string, e string) (map[string]string, error) {
-	var res map[string]string = make(map[string]string)
-
-	imports, err := getImportOrder(p, e)
+	res, err := CreateNameSpaceFS(rootedFS{FS: os.DirFS(filepath.Dir(p)), root: filepath.Dir(p)}, filepath.Base(p), nil, e, "\"", false)
 	if err != nil {
-		return make(map[string]string), fmt.Errorf("in CreateNameSpace(%v, %v):\n%+w", p, e, err)
+		return res, fmt.Errorf("in CreateNameSpace(%v, %v):\n%+w", p, e, err)
 	}
-	for _, imp := range imports {
-		gram, _, _ := strings.Cut(cleanImportStatement(imp), ".")
-		path, err := findGrammar(p, gram, e)
+
+	return res, nil
+}
+
+// Collects all required rules from grammar files in the search path
+// - Grammar files with extension e are found by their package path or indexed once by name, see findGrammar. If search is empty, the subdirectories of the provided path in fsys are searched
+// - Reads import order from the root grammar
+// - For each imported grammar, reads each import statement and rule
+// - Only the rules selected by import statements are collected, see getImportedRules
+// - Rules are stored under their fully qualified names <gram.rule>, with references qualified against their own grammar
+// - If strict, checks that only public rules of an imported grammar are referenced from outside of it
+// Returns an error if the required grammars cannot be found or opened, or if a private rule is referenced from another grammar in strict mode
+func CreateNameSpaceFS(fsys fs.FS, p string, search []fs.FS, e string, q string, strict bool) (map[string]string, error) {
+	res, _, err := createNameSpace(fsys, p, search, e, q, strict)
+
+	return res, err
+}
+
+// Collects all required rules from grammar files in the search path as in CreateNameSpaceFS, along with the source of each rule statement
+func createNameSpace(fsys fs.FS, p string, search []fs.FS, e string, q string, strict bool) (map[string]string, map[string]source, error) {
+	var (
+		res      map[string]string            = make(map[string]string)
+		src      map[string]source            = make(map[string]source)
+		peeks    map[string]grammarPeek       = make(map[string]grammarPeek)
+		grams    map[string]map[string]string = make(map[string]map[string]string)
+		public   map[string][]string          = make(map[string][]string)
+		paths    map[string]string            = make(map[string]string)
+		selected map[string][]string          = make(map[string][]string)
+		order    []string
+	)
+
+	if len(search) == 0 {
+		sub, err := fs.Sub(fsys, path.Dir(path.Clean(p)))
 		if err != nil {
-			return make(map[string]string), fmt.Errorf("in CreateNameSpace(%v, %v):\n%+w", p, e, err)
+			return res, src, fmt.Errorf("in CreateNameSpaceFS(%v, %v, %v, %v):\n%+w", p, e, q, strict, err)
+		}
+		search = []fs.FS{rootedFS{FS: sub, root: filePath(fsys, path.Dir(path.Clean(p)))}}
+	}
+	index := newGrammarIndex(search, e, q)
+	lex := NewJSGFLexer(q)
+	imps, err := getImportOrder(fsys, p, index, q)
+	if err != nil {
+		return res, src, fmt.Errorf("in CreateNameSpaceFS(%v, %v, %v, %v):\n%+w", p, e, q, strict, err)
+	}
+	for _, imp := range imps {
+		gram, rule := splitImport(cleanImportStatement(imp), index.has)
+		_, ok := grams[gram]
+		if !ok {
+			file, err := findGrammar(index, gram)
+			if err != nil {
+				return res, src, fmt.Errorf("in CreateNameSpaceFS(%v, %v, %v, %v):\n%+w", p, e, q, strict, err)
+			}
+			peek, err := peekGrammar(file.fsys, file.path, q)
+			if err != nil {
+				return res, src, fmt.Errorf("in CreateNameSpaceFS(%v, %v, %v, %v):\n%+w", p, e, q, strict, err)
+			}
+			peeks[gram] = peek
+			grams[gram] = peek.rules
+			public[gram] = peek.public
+			paths[gram] = filePath(file.fsys, file.path)
+			order = append(order, gram)
+		}
+		for _, r := range getImportedRules(gram, rule, grams[gram], public[gram], lex) {
+			if !slices.Contains(selected[gram], r) {
+				selected[gram] = append(selected[gram], r)
+			}
 		}
-		_, _, rules, err := peekGrammar(path)
+	}
+	if strict {
+		root, err := peekGrammar(fsys, p, q)
+		if err != nil && !hasStatementErrors(err) {
+			return res, src, fmt.Errorf("in CreateNameSpaceFS(%v, %v, %v, %v):\n%+w", p, e, q, strict, err)
+		}
+		err = validateVisibility(filePath(fsys, p), root.name, root.rules, root.ruleSrc, grams, public, lex)
 		if err != nil {
-			return make(map[string]string), fmt.Errorf("in CreateNameSpace(%v, %v):\n%+w", p, e, err)
+			return res, src, fmt.Errorf("in CreateNameSpaceFS(%v, %v, %v, %v):\n%+w", p, e, q, strict, err)
+		}
+		for _, gram := range order {
+			err = validateVisibility(paths[gram], gram, grams[gram], peeks[gram].ruleSrc, grams, public, lex)
+			if err != nil {
+				return res, src, fmt.Errorf("in CreateNameSpaceFS(%v, %v, %v, %v):\n%+w", p, e, q, strict, err)
+			}
 		}
-		for k, v := range rules {
-			res[k] = v
+	}
+	for _, gram := range order {
+		for _, k := range selected[gram] {
+			res[qualifyReference(k, gram)] = qualifyReferences(grams[gram][k], gram, grams, peeks[gram].imports, lex)
+			src[qualifyReference(k, gram)] = peeks[gram].ruleSrc[k]
 		}
 	}
 
-	return res, nil
+	return res, src, nil
+}
+
+// Checks that the rules of grammar gram, read from file p, only reference public rules of the grammars it imports
+// - Qualified references <other.rule> must point to a public rule
+// - Unqualified references that are not defined in gram must match at least one public rule in the namespace
+// Returns an error at the position of the reference to the private rule, taken from the rule statements in src if available, or otherwise naming the importing file
+func validateVisibility(p string, gram string, rules map[string]string, src map[string]source, grams map[string]map[string]string, public map[string][]string, lex *tokenizer.Tokenizer) error {
+	for _, k := range slices.Sorted(maps.Keys(rules)) {
+		refs, spans := referenceSpans(rules[k], lex)
+		for j, ref := range refs {
+			var private []string
+
+			if isSpecialRule(ref) {
+				continue
+			}
+			i := strings.LastIndex(ref, ".")
+			other, name, ok := strings.Trim(ref[:max(i, 0)], "<"), strings.Trim(ref[i+1:], "<>"), i != -1
+			switch {
+			case ok && other != gram && other != simpleGrammarName(gram):
+				for _, g := range slices.Sorted(maps.Keys(grams)) {
+					if g != other && simpleGrammarName(g) != other {
+						continue
+					}
+					_, defined := grams[g]["<"+name+">"]
+					if defined && !slices.Contains(public[g], "<"+name+">") {
+						private = append(private, ref)
+					}
+				}
+			case !ok:
+				_, defined := rules[ref]
+				if defined {
+					continue
+				}
+				for _, other := range slices.Sorted(maps.Keys(grams)) {
+					_, defined := grams[other][ref]
+					if !defined {
+						continue
+					}
+					if slices.Contains(public[other], ref) {
+						private = []string{}
+						break
+					}
+					private = append(private, qualifyReference(ref, other))
+				}
+			}
+			if len(private) > 0 {
+				pos := Position{File: p}
+				st, ok := src[k]
+				if ok {
+					pos = ruleExpansion(st).position(spans[j].Start)
+				}
+				return fmt.Errorf("error when calling validateVisibility(%v, %v), rule %v:\n%+w", p, gram, private[0], &SourceError{Pos: pos, Text: private[0], Err: ErrPrivateRule})
+			}
+		}
+	}
+
+	return nil
+}
+
+// Returns the rules of grammar gram selected by an import statement <gram.rule>
+// - A single rule imports that rule and all rules of gram it transitively references
+// - A wildcard <gram.*> or bare <gram> import brings in all public rules of gram and the rules they reference
+// Rules that are not defined in gram are ignored, and are left for the grammar completeness check
+func getImportedRules(gram string, rule string, rules map[string]string, public []string, lex *tokenizer.Tokenizer) []string {
+	var (
+		queue []string
+		res   []string
+		r     string
+	)
+
+	switch rule {
+	case "*", "":
+		queue = slices.Sorted(slices.Values(public))
+	default:
+		queue = []string{"<" + rule + ">"}
+	}
+	for len(queue) > 0 {
+		r, queue = queue[0], queue[1:]
+		_, ok := rules[r]
+		if !ok || slices.Contains(res, r) {
+			continue
+		}
+		res = append(res, r)
+		refs, _ := referenceSpans(rules[r], lex)
+		for _, ref := range refs {
+			queue = append(queue, unqualifyReference(ref, gram))
+		}
+	}
+
+	return res
+}
+
+// Returns the fully qualified name <gram.rule> of a local rule reference <rule>
+func qualifyReference(r string, gram string) string {
+	if strings.Contains(r, ".") {
+		return r
+	}
+
+	return "<" + gram + "." + strings.TrimPrefix(r, "<")
+}
+
+// Qualifies each rule reference in an imported rule's expansion
+// - References to rules defined in the same grammar, including ones qualified with its simple name as in <tea.rule>, are qualified with that grammar's full name
+// - References to rules defined in exactly one of the grammar's imports are qualified with the imported grammar's name
+// - Special rules, qualified references, and all other references are left as is
+func qualifyReferences(s string, gram string, grams map[string]map[string]string, imports []string, lex *tokenizer.Tokenizer) string {
+	return rewriteReferences(s, lex, func(r string) string {
+		var matches []string
+
+		r = unqualifyReference(r, gram)
+		if isSpecialRule(r) || strings.Contains(r, ".") {
+			return r
+		}
+		_, ok := grams[gram][r]
+		if ok {
+			return qualifyReference(r, gram)
+		}
+		for _, imp := range imports {
+			g, _ := splitImport(cleanImportStatement(imp), func(g string) bool {
+				_, ok := grams[g]
+
+				return ok
+			})
+			_, ok := grams[g][r]
+			if ok && !slices.Contains(matches, g) {
+				matches = append(matches, g)
+			}
+		}
+		if len(matches) == 1 {
+			return qualifyReference(r, matches[0])
+		}
+
+		return r
+	})
 }
 
-// Checks the specified grammar file and returns the name, imports, and rules specified in the grammar
+// Contents of a grammar file read by peekGrammar, without building rule graphs
+// - imports holds full import statements, and rules the expansion of each rule by name
+// - importSrc and ruleSrc hold the source of each import statement and rule statement, used to report errors at their position in the file
+type grammarPeek struct {
+	name      string
+	imports   []string
+	rules     map[string]string
+	public    []string
+	importSrc []source
+	ruleSrc   map[string]source
+}
+
+// Checks the specified grammar file in fsys and returns the name, imports, rules, and public rule names specified in the grammar
 // Returns an error if the specified file cannot be opened or converted to grammar
-func peekGrammar(p string) (string, []string, map[string]string, error) {
+// Invalid statements are skipped, and returned together as an ErrorList along with the rest of the grammar
+func peekGrammar(fsys fs.FS, p string, q string) (grammarPeek, error) {
 	var (
-		err     error
-		name    string
-		imports []string
-		rules   map[string]string = make(map[string]string)
-		ext     string            = filepath.Ext(p)
-		scanner *bufio.Scanner
+		err      error
+		errs     ErrorList
+		res      grammarPeek             = grammarPeek{rules: make(map[string]string), ruleSrc: make(map[string]source)}
+		ext      string                  = path.Ext(p)
+		file     string                  = filePath(fsys, p)
+		relocate func(Position) Position = inFile(file)
+		scanner  *bufio.Scanner
 	)
 
-	f, err := os.Open(p)
+	f, err := fsys.Open(path.Clean(p))
 	if err != nil {
-		return "", []string{}, map[string]string{}, fmt.Errorf("in PeekGrammar(%v):\n%+w", p, err)
+		return res, fmt.Errorf("in PeekGrammar(%v):\n%+w", file, err)
 	}
+	defer f.Close()
 	info, err := f.Stat()
 	if err != nil {
-		return "", []string{}, map[string]string{}, fmt.Errorf("in PeekGrammar(%v):\n%+w", p, err)
+		return res, fmt.Errorf("in PeekGrammar(%v):\n%+w", file, err)
 	}
 	if info.IsDir() {
-		return "", []string{}, map[string]string{}, fmt.Errorf("in PeekGrammar(%v):\n%+w", p, errors.New("provided path is a directory"))
+		return res, fmt.Errorf("in PeekGrammar(%v):\n%+w", file, errors.New("provided path is a directory"))
 	}
 
 	switch ext {
 	case ".jsgf":
-		scanner = bufio.NewScanner(f)
+		scanner, err = decodedScanner(f)
+		if err != nil {
+			return res, fmt.Errorf("in PeekGrammar(%v):\n%+w", file, err)
+		}
 	case ".jjsgf":
 		var jj JJSGFGrammarJSON
 		err = json.NewDecoder(f).Decode(&jj)
 		if err != nil {
-			return "", []string{}, map[string]string{}, fmt.Errorf("in PeekGrammar(%v):\n%+w", p, errors.New("error decoding json file"))
+			return res, fmt.Errorf("in PeekGrammar(%v):\n%+w", file, &SourceError{Pos: Position{File: file}, Err: fmt.Errorf("%w, %w", ErrInvalidJJSGF, err)})
 		}
 		scanner = bufio.NewScanner(strings.NewReader(JJSGFToJSGF(jj)))
+		relocate = func(pos Position) Position {
+			return fileOnly(inFile(file)(pos))
+		}
 	default:
-		return "", []string{}, map[string]string{}, fmt.Errorf("in PeekGrammar(%v):\n%+w", p, errors.New("unsupported extension, not one of .jsgf, .jjsgf"))
+		return res, fmt.Errorf("in PeekGrammar(%v):\n%+w", file, ErrUnsupportedFormat)
 	}
 
-	for scanner.Scan() {
-		line := scanner.Text()
+	statements, err := readStatements(scanner, q)
+	if err != nil {
+		errs.add(updateErrorPosition(err, relocate), Position{File: file}, "")
+	}
+	for _, st := range statements {
+		line := st.text
+		src := st.source().update(relocate)
 		switch {
 		case strings.HasPrefix(line, "grammar "):
 			err = ValidateJSGFName(line)
 			if err != nil {
-				return name, imports, rules, fmt.Errorf("in PeekGrammar(%v):\n%+w", p, err)
+				errs = append(errs, &SourceError{Pos: src.position(0), Text: line, Err: err})
+				continue
 			}
-			name = cleanGrammarStatement(line)
+			res.name = cleanGrammarStatement(line)
 		case strings.HasPrefix(line, "import <"):
 			err = ValidateJSGFImport(line)
 			if err != nil {
-				return name, imports, rules, fmt.Errorf("in PeekGrammar(%v):\n%+w", p, err)
+				errs = append(errs, &SourceError{Pos: src.position(0), Text: line, Err: err})
+				continue
 			}
-			imports = append(imports, line)
+			res.imports = append(res.imports, line)
+			res.importSrc = append(res.importSrc, src)
 		case strings.HasPrefix(line, "<") || strings.HasPrefix(line, "public <"):
 			err = ValidateJSGFRule(line)
 			if err != nil {
-				return name, imports, rules, fmt.Errorf("in PeekGrammar(%v):\n%+w", p, err)
+				errs = append(errs, &SourceError{Pos: src.position(0), Text: line, Err: err})
+				continue
 			}
 			name, rule, _ := strings.Cut(line, "=")
-			name = strings.TrimSpace(name)
-			name = strings.TrimPrefix(name, "public ")
-			rules[name] = strings.TrimSpace(rule)
-		default:
+			name = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(name), "public "))
+			prev, ok := res.ruleSrc[name]
+			if ok {
+				errs = append(errs, &SourceError{Pos: src.position(strings.Index(line, "<")), Text: name, Prev: prev.position(strings.Index(prev.text, "<")), Err: ErrDuplicateRule})
+				continue
+			}
+			if strings.HasPrefix(line, "public ") {
+				res.public = append(res.public, name)
+			}
+			res.rules[name] = strings.TrimSpace(rule)
+			res.ruleSrc[name] = src
+		case strings.HasPrefix(line, "#JSGF"), isEmptyStatement(line):
 			continue
+		default:
+			errs = append(errs, &SourceError{Pos: src.position(0), Text: line, Err: ErrInvalidStatement})
 		}
 	}
 
-	return name, imports, rules, nil
+	if len(errs) > 0 {
+		return res, fmt.Errorf("in PeekGrammar(%v):\n%+w", file, errs.err())
+	}
+
+	return res, nil
 }
 
-// Returns the on-disk location of the specified grammar by checking each subdirectory of the specified path
-// Returns an error if the target grammar is not found in files with given extension
-func findGrammar(p string, t string, e string) (string, error) {
-	var target string
-	var found bool
+// Checks if err only reports invalid statements, in which case the rest of the grammar was still read, see peekGrammar
+// Statement errors in the root grammar are reported when the grammar itself is loaded, and in imported grammars when they are imported
+func hasStatementErrors(err error) bool {
+	var errs ErrorList
 
-	err := filepath.Walk(filepath.Dir(p), func(path string, info os.FileInfo, err error) error {
-		if filepath.Ext(path) == e {
-			name, _, _, err := peekGrammar(path)
-			if err != nil {
-				return err
-			}
-			if name == t {
-				found = true
-				target = path
+	return errors.As(err, &errs)
+}
+
+// Location of a grammar file within one of the file systems in the search path
+type grammarFile struct {
+	fsys fs.FS
+	path string
+}
+
+// Locates grammar files with extension e by name within the file systems of the search path
+// - names is only filled in the first time a grammar cannot be found by its package path, see scan
+// - paths caches the result of looking up each grammar name by its package path, where a missing file is stored as the zero grammarFile
+type grammarIndex struct {
+	search  []fs.FS
+	e       string
+	q       string
+	names   map[string]grammarFile
+	paths   map[string]grammarFile
+	scanned bool
+}
 
-				return io.EOF
+// Returns an empty grammar index over the provided search path
+func newGrammarIndex(search []fs.FS, e string, q string) *grammarIndex {
+	return &grammarIndex{search: search, e: e, q: q, names: make(map[string]grammarFile), paths: make(map[string]grammarFile)}
+}
+
+// Maps the names of grammars declared in files with the index's extension to their locations, walking each file system in the search path in order
+// - If more than one file declares the same grammar name, the first one found takes precedence
+// - Files and directories that cannot be read as grammars are skipped, so they do not hide the grammars declared next to them
+// - The search path is only walked once, later calls return immediately
+func (x *grammarIndex) scan() {
+	if x.scanned {
+		return
+	}
+	x.scanned = true
+	for _, fsys := range x.search {
+		fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+			if err != nil || path.Ext(p) != x.e || d.IsDir() {
+				return nil
+			}
+			peek, err := peekGrammar(fsys, p, x.q)
+			if err != nil && !hasStatementErrors(err) {
+				return nil
+			}
+			_, ok := x.names[peek.name]
+			if !ok {
+				x.names[peek.name] = grammarFile{fsys: fsys, path: p}
 			}
+
+			return nil
+		})
+	}
+}
+
+// Checks if a grammar with the given name can be found in the search path
+func (x *grammarIndex) has(t string) bool {
+	_, err := findGrammar(x, t)
+
+	return err == nil
+}
+
+// Returns the location of the package path of a grammar name, as in com/acme/food/tea.jsgf for com.acme.food.tea
+func grammarPackagePath(t string, e string) string {
+	return strings.ReplaceAll(t, ".", "/") + e
+}
+
+// Returns the first file in the search path at the package path of grammar t that declares t, or the zero grammarFile if there is none
+// The result is cached, so each package path is only read once per index
+func (x *grammarIndex) packageFile(t string) grammarFile {
+	file, ok := x.paths[t]
+	if ok {
+		return file
+	}
+	p := grammarPackagePath(t, x.e)
+	for _, fsys := range x.search {
+		if !fs.ValidPath(p) {
+			break
+		}
+		_, err := fs.Stat(fsys, p)
+		if err != nil {
+			continue
+		}
+		peek, err := peekGrammar(fsys, p, x.q)
+		if err == nil && peek.name == t {
+			file = grammarFile{fsys: fsys, path: p}
+			break
 		}
+	}
+	x.paths[t] = file
 
-		return nil
-	})
-	if err == io.EOF {
-		err = nil
+	return file
+}
+
+// Returns the location of the specified grammar in the search path
+// - Each file system is first checked for a file at the grammar's package path that declares the grammar, see grammarIndex.packageFile
+// - Otherwise, the grammar is looked up in the index of all grammar files in the search path, see grammarIndex.scan
+// Returns an error if the target grammar is not declared in any readable file of the search path
+func findGrammar(x *grammarIndex, t string) (grammarFile, error) {
+	file := x.packageFile(t)
+	if file.fsys != nil {
+		return file, nil
 	}
-	if err != nil {
-		return "", fmt.Errorf("error when calling FindGrammar(%v, %v, %v):\n%+w", p, t, e, err)
+	x.scan()
+	file, ok := x.names[t]
+	if !ok {
+		return file, fmt.Errorf("error when calling FindGrammar(%v):\n%+w", t, fmt.Errorf("%w, not declared in available directories", ErrGrammarNotFound))
 	}
-	if !found {
-		return "", fmt.Errorf("error when calling FindGrammar(%v, %v, %v):\n%+w", p, t, e, errors.New("grammar not declared in available directories"))
+
+	return file, nil
+}
+
+// Splits the target of an import statement into a grammar name and a rule name
+// - <gram.rule> and <gram.*> are split at the last ., so the grammar name may be package qualified as in <com.acme.food.tea.*>
+// - A bare grammar name <gram> is returned with an empty rule name, if isGrammar(gram) and gram is not itself followed by a rule name
+func splitImport(s string, isGrammar func(string) bool) (string, string) {
+	i := strings.LastIndex(s, ".")
+	switch {
+	case i == -1:
+		return s, ""
+	case s[i+1:] == "*", isGrammar(s[:i]):
+		return s[:i], s[i+1:]
+	case isGrammar(s):
+		return s, ""
+	default:
+		return s[:i], s[i+1:]
 	}
+}
 
-	return target, nil
+// Returns the simple name of a package qualified grammar name, as in tea for com.acme.food.tea
+func simpleGrammarName(gram string) string {
+	return gram[strings.LastIndex(gram, ".")+1:]
 }
 
-// Returns the dependencies of the giben grammar file by traversing each listed grammar and its imports, in order
-// Returns an error if the file cannot be opened or located
-func getImportOrder(p string, e string) ([]string, error) {
+// Removes the full and simple grammar name qualifiers from each reference to a grammar's own rules in an expression, see unqualifyReference
+// Quoted text is left as is, see rewriteReferences
+func unqualifyReferences(s string, gram string, lex *tokenizer.Tokenizer) string {
+	return rewriteReferences(s, lex, func(r string) string {
+		return unqualifyReference(r, gram)
+	})
+}
+
+// Removes the full or simple grammar name qualifier from a reference to a grammar's own rule, as in <com.acme.food.tea.rule> or <tea.rule> to <rule>
+func unqualifyReference(r string, gram string) string {
+	switch {
+	case strings.HasPrefix(r, "<"+gram+"."):
+		return "<" + strings.TrimPrefix(r, "<"+gram+".")
+	case strings.HasPrefix(r, "<"+simpleGrammarName(gram)+"."):
+		return "<" + strings.TrimPrefix(r, "<"+simpleGrammarName(gram)+".")
+	default:
+		return r
+	}
+}
+
+// Returns the dependencies of the given grammar file in fsys by traversing each listed grammar and its imports, in order
+// - Each grammar's imports are only read the first time the grammar is visited, so mutual imports are allowed
+// - Duplicate import statements are only returned once
+// Returns an error if the file cannot be opened or located, including the chain of imports that led to the missing grammar
+func getImportOrder(fsys fs.FS, p string, index *grammarIndex, q string) ([]string, error) {
 	var (
 		imports []string
 		imp     string
+		srcs    []source
+		src     source
+		chains  [][]string
+		chain   []string
+		visited []string
 		res     []string
 	)
-	_, imports, _, err := peekGrammar(p)
-	if err != nil {
-		return imports, fmt.Errorf("in GetImportOrder(%v, %v):\n%+w", p, e, err)
+	root, err := peekGrammar(fsys, p, q)
+	if err != nil && !hasStatementErrors(err) {
+		return imports, fmt.Errorf("in GetImportOrder(%v):\n%+w", p, err)
+	}
+	imports, srcs = root.imports, root.importSrc
+	visited = append(visited, root.name)
+	for range imports {
+		chains = append(chains, []string{root.name})
 	}
 	for len(imports) > 0 {
 		imp, imports = imports[0], imports[1:]
-		gram, _, _ := strings.Cut(cleanImportStatement(imp), ".")
-		path, err := findGrammar(p, gram, e)
+		src, srcs = srcs[0], srcs[1:]
+		chain, chains = chains[0], chains[1:]
+		if slices.Contains(res, imp) {
+			continue
+		}
+		res = append(res, imp)
+		gram, _ := splitImport(cleanImportStatement(imp), index.has)
+		if slices.Contains(visited, gram) {
+			continue
+		}
+		visited = append(visited, gram)
+		chain = append(slices.Clone(chain), gram)
+		file, err := findGrammar(index, gram)
+		var se *SourceError
+		if err != nil && !errors.As(err, &se) {
+			err = &SourceError{Pos: src.position(strings.Index(imp, "<") + 1), Msg: ErrGrammarNotFound.Error(), Text: fmt.Sprintf("%v, import chain %v", gram, strings.Join(chain, " -> ")), Err: err}
+		}
 		if err != nil {
-			return []string{}, fmt.Errorf("in GetImportOrder(%v, %v):\n%+w", p, e, err)
+			return []string{}, fmt.Errorf("in GetImportOrder(%v), import chain %v:\n%+w", p, strings.Join(chain, " -> "), err)
 		}
-		_, imps, _, err := peekGrammar(path)
+		peek, err := peekGrammar(file.fsys, file.path, q)
 		if err != nil {
-			return []string{}, fmt.Errorf("in GetImportOrder(%v, %v):\n%+w", p, e, err)
+			return []string{}, fmt.Errorf("in GetImportOrder(%v), import chain %v:\n%+w", p, strings.Join(chain, " -> "), err)
+		}
+		imports = append(imports, peek.imports...)
+		srcs = append(srcs, peek.importSrc...)
+		for range peek.imports {
+			chains = append(chains, chain)
 		}
-		imports = append(imports, imps...)
-		res = append(res, imp)
 	}
 
 	return res, nil
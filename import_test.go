@@ -3,18 +3,25 @@
 // Created on Sat Feb 15 05:19:15 PM EST 2025
 // author: Ryan Hildebrandt, github.com/ryancahildebrandt
 
-package main
+package gsgf
 
 import (
+	"io/fs"
+	"maps"
+	"os"
+	"path"
 	"slices"
 	"sort"
+	"strings"
 	"testing"
+	"testing/fstest"
 )
 
 func TestCreateNameSpace(t *testing.T) {
 	table := []struct {
 		d       string
 		e       string
+		s       bool
 		r       map[string]string
 		wantErr bool
 	}{
@@ -22,10 +29,10 @@ func TestCreateNameSpace(t *testing.T) {
 			d: "data/tests/test0.jsgf",
 			e: ".jsgf",
 			r: map[string]string{
-				"<order>":   "i'd like [to order|a|<quant>];",
-				"<request>": "[(could|will|would) you] please <brew>;",
-				"<quant>":   "some|a (cup|glass) of;",
-				"<brew>":    "(make|brew|whip up) <quant>;",
+				"<a.brew>":    "(make|brew|whip up) <a.quant>;",
+				"<a.order>":   "i'd like [to order|a|<a.quant>];",
+				"<a.quant>":   "some|a (cup|glass) of;",
+				"<a.request>": "[(could|will|would) you] please <a.brew>;",
 			},
 			wantErr: false,
 		},
@@ -33,10 +40,10 @@ func TestCreateNameSpace(t *testing.T) {
 			d: "data/tests/test0.jjsgf",
 			e: ".jjsgf",
 			r: map[string]string{
-				"<order>":   "i'd like [to order|a|<quant>];",
-				"<request>": "[(could|will|would) you] please <brew>;",
-				"<quant>":   "some|a (cup|glass) of;",
-				"<brew>":    "(make|brew|whip up) <quant>;",
+				"<a.brew>":    "(make|brew|whip up) <a.quant>;",
+				"<a.order>":   "i'd like [to order|a|<a.quant>];",
+				"<a.quant>":   "some|a (cup|glass) of;",
+				"<a.request>": "[(could|will|would) you] please <a.brew>;",
 			},
 			wantErr: false,
 		},
@@ -44,9 +51,8 @@ func TestCreateNameSpace(t *testing.T) {
 			d: "data/tests/test1.jsgf",
 			e: ".jsgf",
 			r: map[string]string{
-				"<brew>":    "(make|brew|whip up) <quant>;",
-				"<teatype>": "red|sweet|green|jasmine|milk;",
-				"<quant>":   "some|a (cup|glass) of;",
+				"<c.brew>":  "(make|brew|whip up) <c.quant>;",
+				"<c.quant>": "some|a (cup|glass) of;",
 			},
 			wantErr: false,
 		},
@@ -57,27 +63,18 @@ func TestCreateNameSpace(t *testing.T) {
 			wantErr: true,
 		},
 		{
-			d: "data/tests/test3.jsgf",
-			e: ".jsgf",
-			r: map[string]string{
-				"<request>": "[(could|will|would) you] please <brew>;",
-				"<order>":   "i'd like [to order|a|<quant>];",
-				"<quant>":   "some|a (cup|glass) of;",
-				"<teatype>": "red|sweet|green|jasmine|milk;",
-				"<brew>":    "(make|brew|whip up) <quant>;",
-				"<main>":    "(<request>|<order>) <quant> <teatype> tea;",
-			},
+			d:       "data/tests/test3.jsgf",
+			e:       ".jsgf",
+			r:       map[string]string{},
 			wantErr: false,
 		},
 		{
 			d: "data/tests/test4.jsgf",
 			e: ".jsgf",
 			r: map[string]string{
-				"<order>":   "i'd like [to order|a|<quant>];",
-				"<quant>":   "some|a (cup|glass) of;",
-				"<teatype>": "red|sweet|green|jasmine|milk;",
-				"<request>": "[(could|will|would) you] please <brew>;",
-				"<brew>":    "(make|brew|whip up) <quant>;",
+				"<a.order>":   "i'd like [to order|a|<a.quant>];",
+				"<a.quant>":   "some|a (cup|glass) of;",
+				"<c.teatype>": "red|sweet|green|jasmine|milk;",
 			},
 			wantErr: false,
 		},
@@ -85,11 +82,9 @@ func TestCreateNameSpace(t *testing.T) {
 			d: "data/tests/test4.jjsgf",
 			e: ".jjsgf",
 			r: map[string]string{
-				"<order>":   "i'd like [to order|a|<quant>];",
-				"<quant>":   "some|a (cup|glass) of;",
-				"<teatype>": "red|sweet|green|jasmine|milk;",
-				"<request>": "[(could|will|would) you] please <brew>;",
-				"<brew>":    "(make|brew|whip up) <quant>;",
+				"<a.order>":   "i'd like [to order|a|<a.quant>];",
+				"<a.quant>":   "some|a (cup|glass) of;",
+				"<c.teatype>": "red|sweet|green|jasmine|milk;",
 			},
 			wantErr: false,
 		},
@@ -97,11 +92,9 @@ func TestCreateNameSpace(t *testing.T) {
 			d: "data/tests/test5.jsgf",
 			e: ".jsgf",
 			r: map[string]string{
-				"<request>": "[(could|will|would) you] please <brew>;",
-				"<brew>":    "(make|brew|whip up) <quant>;",
-				"<order>":   "i'd like [to order|a|<quant>];",
-				"<teatype>": "red|sweet|green|jasmine|milk;",
-				"<quant>":   "some|a (cup|glass) of;",
+				"<b.request>": "[(could|will|would) you] please <c.brew>;",
+				"<c.brew>":    "(make|brew|whip up) <c.quant>;",
+				"<c.quant>":   "some|a (cup|glass) of;",
 			},
 			wantErr: false,
 		},
@@ -109,11 +102,8 @@ func TestCreateNameSpace(t *testing.T) {
 			d: "data/tests/test6.jsgf",
 			e: ".jsgf",
 			r: map[string]string{
-				"<request>": "[(could|will|would) you] please <brew>;",
-				"<brew>":    "(make|brew|whip up) <quant>;",
-				"<order>":   "i'd like [to order|a|<quant>];",
-				"<teatype>": "red|sweet|green|jasmine|milk;",
-				"<quant>":   "some|a (cup|glass) of;",
+				"<c.brew>":  "(make|brew|whip up) <c.quant>;",
+				"<c.quant>": "some|a (cup|glass) of;",
 			},
 			wantErr: false,
 		},
@@ -127,9 +117,8 @@ func TestCreateNameSpace(t *testing.T) {
 			d: "data/tests/b.jsgf",
 			e: ".jsgf",
 			r: map[string]string{
-				"<brew>":    "(make|brew|whip up) <quant>;",
-				"<teatype>": "red|sweet|green|jasmine|milk;",
-				"<quant>":   "some|a (cup|glass) of;",
+				"<c.brew>":  "(make|brew|whip up) <c.quant>;",
+				"<c.quant>": "some|a (cup|glass) of;",
 			},
 			wantErr: false,
 		},
@@ -163,58 +152,207 @@ func TestCreateNameSpace(t *testing.T) {
 			r:       map[string]string{},
 			wantErr: false,
 		},
+		{
+			d: "data/tests/strict/strict0.jsgf",
+			e: ".jsgf",
+			s: true,
+			r: map[string]string{
+				"<lib.drink>":   "<lib.quant> <lib.teatype> tea;",
+				"<lib.teatype>": "red|sweet|green|jasmine|milk;",
+				"<lib.quant>":   "some|a (cup|glass) of;",
+			},
+			wantErr: false,
+		},
+		{
+			d: "data/tests/strict/strict1.jsgf",
+			e: ".jsgf",
+			s: false,
+			r: map[string]string{
+				"<lib.drink>":   "<lib.quant> <lib.teatype> tea;",
+				"<lib.teatype>": "red|sweet|green|jasmine|milk;",
+				"<lib.quant>":   "some|a (cup|glass) of;",
+			},
+			wantErr: false,
+		},
+		{
+			d:       "data/tests/strict/strict1.jsgf",
+			e:       ".jsgf",
+			s:       true,
+			r:       map[string]string{},
+			wantErr: true,
+		},
+		{
+			d: "data/tests/strict/strict2.jsgf",
+			e: ".jsgf",
+			s: false,
+			r: map[string]string{
+				"<lib2.order>":  "i'd like <lib.quant> <lib.teatype> tea;",
+				"<lib.drink>":   "<lib.quant> <lib.teatype> tea;",
+				"<lib.teatype>": "red|sweet|green|jasmine|milk;",
+				"<lib.quant>":   "some|a (cup|glass) of;",
+			},
+			wantErr: false,
+		},
+		{
+			d:       "data/tests/strict/strict2.jsgf",
+			e:       ".jsgf",
+			s:       true,
+			r:       map[string]string{},
+			wantErr: true,
+		},
+		{
+			d: "data/tests/mutual/m0.jsgf",
+			e: ".jsgf",
+			r: map[string]string{
+				"<m1.drink>":   "<m1.quant> <m2.teatype> tea;",
+				"<m1.quant>":   "some|a (cup|glass) of;",
+				"<m2.teatype>": "red|sweet|green|jasmine|milk;",
+				"<m2.order>":   "<m1.quant> <m2.teatype> tea;",
+			},
+			wantErr: false,
+		},
+		{
+			d:       "data/tests/mutual/m3.jsgf",
+			e:       ".jsgf",
+			r:       map[string]string{},
+			wantErr: true,
+		},
+		{
+			d: "data/tests/packages/app.jsgf",
+			e: ".jsgf",
+			r: map[string]string{
+				"<com.acme.food.tea.drink>":   "<com.acme.food.tea.teatype> tea;",
+				"<com.acme.food.tea.teatype>": "green | <com.acme.food.tea.black>;",
+				"<com.acme.food.tea.black>":   "black;",
+				"<com.acme.food.sizes.size>":  "small | large;",
+			},
+			wantErr: false,
+		},
+		{
+			d: "data/tests/packages/bare.jsgf",
+			e: ".jsgf",
+			r: map[string]string{
+				"<com.acme.food.tea.drink>":   "<com.acme.food.tea.teatype> tea;",
+				"<com.acme.food.tea.teatype>": "green | <com.acme.food.tea.black>;",
+				"<com.acme.food.tea.black>":   "black;",
+			},
+			wantErr: false,
+		},
 	}
 	for i, test := range table {
-		rules, err := CreateNameSpace(test.d, test.e)
+		rules, err := CreateNameSpaceFS(os.DirFS("."), test.d, nil, test.e, "\"", test.s)
 		if len(rules) != len(test.r) {
-			t.Errorf("test %v: CreateNameSpace(%v, %v).rules\nGOT %v\nWANT %v", i, test.d, test.e, rules, test.r)
+			t.Errorf("test %v: CreateNameSpaceFS(%v, %v, %v).rules\nGOT %v\nWANT %v", i, test.d, test.e, test.s, rules, test.r)
 		}
 		for k1, v1 := range rules {
 			v2, ok := test.r[k1]
 			if !ok {
-				t.Errorf("test %v: CreateNameSpace(%v, %v).rules\nGOT %v\nWANT %v", i, test.d, test.e, v1, v2)
+				t.Errorf("test %v: CreateNameSpaceFS(%v, %v, %v).rules\nGOT %v\nWANT %v", i, test.d, test.e, test.s, v1, v2)
 			}
 			if v1 != v2 {
-				t.Errorf("test %v: CreateNameSpace(%v, %v).rules\nGOT %v\nWANT %v", i, test.d, test.e, v1, v2)
+				t.Errorf("test %v: CreateNameSpaceFS(%v, %v, %v).rules\nGOT %v\nWANT %v", i, test.d, test.e, test.s, v1, v2)
 			}
 		}
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: CreateNameSpaceFS(%v, %v, %v).err\nGOT %v\nWANT %v", i, test.d, test.e, test.s, err, test.wantErr)
+		}
+		if test.s {
+			continue
+		}
+		local, err := CreateNameSpace(test.d, test.e)
+		if !maps.Equal(local, rules) {
+			t.Errorf("test %v: CreateNameSpace(%v, %v).rules\nGOT %v\nWANT %v", i, test.d, test.e, local, rules)
+		}
 		if (err != nil) != test.wantErr {
 			t.Errorf("test %v: CreateNameSpace(%v, %v).err\nGOT %v\nWANT %v", i, test.d, test.e, err, test.wantErr)
 		}
 	}
 }
 
-func TestFindGrammar(t *testing.T) {
+func TestCreateNameSpaceFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"main.jsgf":           {Data: []byte("grammar main;\nimport <lib.drink>;\npublic <main> = <drink>;")},
+		"main.jjsgf":          {Data: []byte(`{"grammar": "main", "imports": ["lib.*"], "public": {"main": "<drink>"}}`)},
+		"sub/aaa_broken.jsgf": {Data: []byte("#JSGF V1.0 bogus-9;\ngrammar broken\xff;")},
+		"sub/lib.jsgf":        {Data: []byte("grammar lib;\npublic <drink> = <teatype> tea;\n<teatype> = green | black;")},
+		"sub/lib.jjsgf":       {Data: []byte(`{"grammar": "lib", "public": {"drink": "<size> tea"}, "rules": {"size": "small | large"}}`)},
+		"other/dne.jsgf":      {Data: []byte("grammar dne2;\npublic <main> = a;")},
+		"missing.jsgf":        {Data: []byte("grammar missing;\nimport <dne.*>;\npublic <main> = <dne>;")},
+	}
 	table := []struct {
 		p       string
+		e       string
+		r       map[string]string
+		wantErr bool
+	}{
+		{p: "main.jsgf", e: ".jsgf", r: map[string]string{"<lib.drink>": "<lib.teatype> tea;", "<lib.teatype>": "green | black;"}, wantErr: false},
+		{p: "main.jjsgf", e: ".jjsgf", r: map[string]string{"<lib.drink>": "<lib.size> tea;", "<lib.size>": "small | large;"}, wantErr: false},
+		{p: "./main.jsgf", e: ".jsgf", r: map[string]string{"<lib.drink>": "<lib.teatype> tea;", "<lib.teatype>": "green | black;"}, wantErr: false},
+		{p: "missing.jsgf", e: ".jsgf", r: map[string]string{}, wantErr: true},
+		{p: "dne.jsgf", e: ".jsgf", r: map[string]string{}, wantErr: true},
+	}
+	for i, test := range table {
+		rules, err := CreateNameSpaceFS(fsys, test.p, nil, test.e, "\"", false)
+		if !maps.Equal(rules, test.r) {
+			t.Errorf("test %v: CreateNameSpaceFS(%v, %v).rules\nGOT %v\nWANT %v", i, test.p, test.e, rules, test.r)
+		}
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: CreateNameSpaceFS(%v, %v).err\nGOT %v\nWANT %v", i, test.p, test.e, err, test.wantErr)
+		}
+	}
+}
+
+func TestFindGrammar(t *testing.T) {
+	table := []struct {
+		search  []string
 		t       string
 		e       string
 		want    string
 		wantErr bool
 	}{
-		{p: "./data/tests/.jsgf", t: "test0", e: ".jsgf", want: "data/tests/test0.jsgf", wantErr: false},
-		{p: "./data/tests/.jsgf", t: "test0", e: ".jjsgf", want: "data/tests/test0.jjsgf", wantErr: false},
-		{p: "./data/tests/test0.jsgf", t: "test0", e: ".jsgf", want: "data/tests/test0.jsgf", wantErr: false},
-		{p: "./data/tests/test0.jsgf", t: "a", e: ".jsgf", want: "data/tests/a.jsgf", wantErr: false},
-		{p: "./data/tests/test0.jsgf", t: "a", e: ".jjsgf", want: "data/tests/a.jjsgf", wantErr: false},
-		{p: "./data/tests/test0.jsgf", t: "e", e: ".jsgf", want: "data/tests/dir0/dir1/dir2/e.jsgf", wantErr: false},
-		{p: "./data/tests/a.jsgf", t: "a", e: ".jsgf", want: "data/tests/a.jsgf", wantErr: false},
-		{p: "./data/tests/dir0/dir1/c.jsgf", t: "d", e: ".jsgf", want: "data/tests/dir0/dir1/d.jsgf", wantErr: false},
-		{p: "./data/tests/dir0/dir1/c.jsgf", t: "e", e: ".jsgf", want: "data/tests/dir0/dir1/dir2/e.jsgf", wantErr: false},
-		{p: "./data/tests/dir0/dir1/dir2/e.jsgf", t: "e", e: ".jsgf", want: "data/tests/dir0/dir1/dir2/e.jsgf", wantErr: false},
-		{p: "./data/tests", t: "test0", e: ".jsgf", want: "data/tests/test0.jsgf", wantErr: false},
-		{p: "./data/tests/dir0/dir1/c.jsgf", t: "b", e: ".jsgf", want: "", wantErr: true},
-		{p: "./data/tests/dir0/dir1/c.jsgf", t: "b", e: ".jjsgf", want: "", wantErr: true},
-		{p: "./data/tests/test0.jsgf", t: "f", e: ".jsgf", want: "", wantErr: true},
-		{p: "./data/tests/dir0/dir1/dir2/e.jsgf", t: "d", e: ".jsgf", want: "", wantErr: true},
+		{search: []string{"data/tests"}, t: "test0", e: ".jsgf", want: "data/tests/test0.jsgf", wantErr: false},
+		{search: []string{"data/tests"}, t: "test0", e: ".jjsgf", want: "data/tests/test0.jjsgf", wantErr: false},
+		{search: []string{"data/tests"}, t: "a", e: ".jsgf", want: "data/tests/a.jsgf", wantErr: false},
+		{search: []string{"data/tests"}, t: "a", e: ".jjsgf", want: "data/tests/a.jjsgf", wantErr: false},
+		{search: []string{"data/tests"}, t: "e", e: ".jsgf", want: "data/tests/dir0/dir1/dir2/e.jsgf", wantErr: false},
+		{search: []string{"data/tests/dir0/dir1"}, t: "d", e: ".jsgf", want: "data/tests/dir0/dir1/d.jsgf", wantErr: false},
+		{search: []string{"data/tests/dir0/dir1"}, t: "e", e: ".jsgf", want: "data/tests/dir0/dir1/dir2/e.jsgf", wantErr: false},
+		{search: []string{"data/tests/dir0/dir1/dir2"}, t: "e", e: ".jsgf", want: "data/tests/dir0/dir1/dir2/e.jsgf", wantErr: false},
+		{search: []string{"data/tests/dir0/dir1/dir2", "data/tests"}, t: "e", e: ".jsgf", want: "data/tests/dir0/dir1/dir2/e.jsgf", wantErr: false},
+		{search: []string{"data/tests/dir0/dir1/dir2", "data/tests"}, t: "a", e: ".jsgf", want: "data/tests/a.jsgf", wantErr: false},
+		{search: []string{"data/tests/strict", "data/tests"}, t: "lib", e: ".jsgf", want: "data/tests/strict/lib.jsgf", wantErr: false},
+		{search: []string{"data/tests/dir0/dir1"}, t: "b", e: ".jsgf", want: "", wantErr: true},
+		{search: []string{"data/tests/dir0/dir1"}, t: "b", e: ".jjsgf", want: "", wantErr: true},
+		{search: []string{"data/tests"}, t: "f", e: ".jsgf", want: "", wantErr: true},
+		{search: []string{"data/tests/dir0/dir1/dir2"}, t: "d", e: ".jsgf", want: "", wantErr: true},
+		{search: []string{}, t: "a", e: ".jsgf", want: "", wantErr: true},
+		{search: []string{"data/tests/packages"}, t: "com.acme.food.tea", e: ".jsgf", want: "data/tests/packages/com/acme/food/tea.jsgf", wantErr: false},
+		{search: []string{"data/tests/packages"}, t: "com.acme.food.sizes", e: ".jsgf", want: "data/tests/packages/misc/sizes.jsgf", wantErr: false},
+		{search: []string{"data/tests/packages"}, t: "com.acme.app", e: ".jsgf", want: "data/tests/packages/app.jsgf", wantErr: false},
+		{search: []string{"data/tests/packages"}, t: "tea", e: ".jsgf", want: "", wantErr: true},
+		{search: []string{"data/tests/packages"}, t: "com.acme.food", e: ".jsgf", want: "", wantErr: true},
 	}
 	for i, test := range table {
-		got, err := findGrammar(test.p, test.t, test.e)
-		if got != test.want {
-			t.Errorf("test %v: FindGrammar(%v, %v, %v)\nGOT %v\nWANT %v", i, test.p, test.t, test.e, got, test.want)
+		var search []fs.FS
+		for _, d := range test.search {
+			search = append(search, os.DirFS(d))
+		}
+		index := newGrammarIndex(search, test.e, "\"")
+		got, err := findGrammar(index, test.t)
+		for j, d := range test.search {
+			if got.fsys == search[j] {
+				got.path = path.Join(d, got.path)
+			}
+		}
+		if got.path != test.want {
+			t.Errorf("test %v: FindGrammar(%v, %v, %v)\nGOT %v\nWANT %v", i, test.search, test.t, test.e, got.path, test.want)
 		}
 		if (err != nil) != test.wantErr {
-			t.Errorf("test %v: FindGrammar(%v, %v, %v).err\nGOT %v\nWANT %v", i, test.p, test.t, test.e, err, test.wantErr)
+			t.Errorf("test %v: FindGrammar(%v, %v, %v).err\nGOT %v\nWANT %v", i, test.search, test.t, test.e, err, test.wantErr)
+		}
+		_, ok := index.paths[test.t]
+		if !ok {
+			t.Errorf("test %v: FindGrammar(%v, %v, %v).paths\nGOT %v\nWANT %v cached", i, test.search, test.t, test.e, index.paths, test.t)
 		}
 	}
 }
@@ -224,12 +362,13 @@ func TestImportOrder(t *testing.T) {
 		p       string
 		e       string
 		want    []string
+		chain   string
 		wantErr bool
 	}{
 		{p: "./data/tests", e: ".jsgf", want: []string{}, wantErr: true},
 		{p: "./data/tests/.jsgf", e: ".jsgf", want: []string{}, wantErr: true},
 		{p: "./data/tests/.jjsgf", e: ".jjsgf", want: []string{}, wantErr: true},
-		{p: "./data/tests/test0.jsgf", e: ".jsgf", want: []string{"import <a.*>;"}, wantErr: false},
+		{p: "./data/tests/test0.jsgf", e: ".jsgf", want: []string{"import <a.request>;", "import <a.order>;"}, wantErr: false},
 		{p: "./data/tests/test1.jsgf", e: ".jsgf", want: []string{"import <c.brew>;"}, wantErr: false},
 		{p: "./data/tests/test1.jjsgf", e: ".jjsgf", want: []string{"import <c.brew>;"}, wantErr: false},
 		{p: "./data/tests/test3.jsgf", e: ".jsgf", want: []string{"import <e.dne>;"}, wantErr: false},
@@ -241,12 +380,18 @@ func TestImportOrder(t *testing.T) {
 		{p: "./data/tests/dir0/c.jsgf", e: ".jsgf", want: []string{}, wantErr: false},
 		{p: "./data/tests/dir0/c.jjsgf", e: ".jjsgf", want: []string{}, wantErr: false},
 		{p: "./data/tests/dir0/dir1/dir2/e.jsgf", e: ".jsgf", want: []string{}, wantErr: false},
-		{p: "./data/tests/test2.jsgf", e: ".jsgf", want: []string{}, wantErr: true},
+		{p: "./data/tests/test2.jsgf", e: ".jsgf", want: []string{}, chain: "test2 -> a1", wantErr: true},
 		{p: "./data/tests/test2.jjsgf", e: ".jjsgf", want: []string{}, wantErr: true},
-		{p: "./data/tests/dir0/dir1/d.jsgf", e: ".jsgf", want: []string{}, wantErr: true},
+		{p: "./data/tests/dir0/dir1/d.jsgf", e: ".jsgf", want: []string{}, chain: "d -> a", wantErr: true},
+		{p: "./data/tests/mutual/m0.jsgf", e: ".jsgf", want: []string{"import <m1.drink>;", "import <m2.*>;", "import <m1.quant>;"}, wantErr: false},
+		{p: "./data/tests/mutual/m1.jsgf", e: ".jsgf", want: []string{"import <m2.*>;", "import <m1.quant>;"}, wantErr: false},
+		{p: "./data/tests/mutual/m2.jsgf", e: ".jsgf", want: []string{"import <m1.quant>;", "import <m2.*>;"}, wantErr: false},
+		{p: "./data/tests/mutual/m3.jsgf", e: ".jsgf", want: []string{}, chain: "m3 -> m4 -> dne", wantErr: true},
+		{p: "./data/tests/mutual/m4.jsgf", e: ".jsgf", want: []string{}, chain: "m4 -> dne", wantErr: true},
 	}
 	for i, test := range table {
-		got, err := getImportOrder(test.p, test.e)
+		index := newGrammarIndex([]fs.FS{os.DirFS(path.Dir(path.Clean(test.p)))}, test.e, "\"")
+		got, err := getImportOrder(os.DirFS("."), test.p, index, "\"")
 		sort.Strings(test.want)
 		sort.Strings(got)
 		if !slices.Equal(got, test.want) {
@@ -255,6 +400,93 @@ func TestImportOrder(t *testing.T) {
 		if (err != nil) != test.wantErr {
 			t.Errorf("test %v: ImportOrder(%v, %v).err\nGOT %v\nWANT %v", i, test.p, test.e, err, test.wantErr)
 		}
+		if test.chain != "" && (err == nil || !strings.Contains(err.Error(), "import chain "+test.chain)) {
+			t.Errorf("test %v: ImportOrder(%v, %v).err\nGOT %v\nWANT %v", i, test.p, test.e, err, test.chain)
+		}
+	}
+}
+
+func TestGetImportedRules(t *testing.T) {
+	rules := map[string]string{
+		"<drink>":   "<quant> <teatype> tea;",
+		"<teatype>": "red|sweet|green|jasmine|milk;",
+		"<quant>":   "some|a <size> of;",
+		"<size>":    "cup|glass;",
+		"<order>":   "i'd like <lib.drink>;",
+		"<other>":   "<other.rule>;",
+		"<quoted>":  "say \"<size>\";",
+	}
+	lexer := NewJSGFLexer("\"")
+	table := []struct {
+		rule   string
+		public []string
+		want   []string
+	}{
+		{rule: "*", public: []string{}, want: []string{}},
+		{rule: "", public: []string{}, want: []string{}},
+		{rule: "dne", public: []string{}, want: []string{}},
+		{rule: "size", public: []string{}, want: []string{"<size>"}},
+		{rule: "quant", public: []string{}, want: []string{"<quant>", "<size>"}},
+		{rule: "drink", public: []string{}, want: []string{"<drink>", "<quant>", "<size>", "<teatype>"}},
+		{rule: "order", public: []string{}, want: []string{"<drink>", "<order>", "<quant>", "<size>", "<teatype>"}},
+		{rule: "other", public: []string{}, want: []string{"<other>"}},
+		{rule: "*", public: []string{"<teatype>"}, want: []string{"<teatype>"}},
+		{rule: "*", public: []string{"<teatype>", "<quant>"}, want: []string{"<quant>", "<size>", "<teatype>"}},
+		{rule: "", public: []string{"<teatype>", "<quant>"}, want: []string{"<quant>", "<size>", "<teatype>"}},
+		{rule: "teatype", public: []string{"<drink>"}, want: []string{"<teatype>"}},
+		{rule: "quoted", public: []string{}, want: []string{"<quoted>"}},
+	}
+	for i, test := range table {
+		got := getImportedRules("lib", test.rule, rules, test.public, lexer)
+		slices.Sort(got)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("test %v: getImportedRules(lib, %v, %v)\nGOT %v\nWANT %v", i, test.rule, test.public, got, test.want)
+		}
+	}
+}
+
+func TestValidateVisibility(t *testing.T) {
+	grams := map[string]map[string]string{
+		"lib": {
+			"<drink>":   "<quant> <teatype> tea;",
+			"<teatype>": "red|sweet|green|jasmine|milk;",
+			"<quant>":   "some|a (cup|glass) of;",
+		},
+		"lib2": {
+			"<quant>": "a cup of;",
+		},
+	}
+	public := map[string][]string{
+		"lib":  {"<drink>", "<teatype>"},
+		"lib2": {"<quant>"},
+	}
+	lexer := NewJSGFLexer("\"")
+	table := []struct {
+		gram    string
+		rules   map[string]string
+		wantErr bool
+	}{
+		{gram: "main", rules: map[string]string{}, wantErr: false},
+		{gram: "main", rules: map[string]string{"<main>": "<drink>;"}, wantErr: false},
+		{gram: "main", rules: map[string]string{"<main>": "<lib.drink> <lib.teatype>;"}, wantErr: false},
+		{gram: "main", rules: map[string]string{"<main>": "<lib.quant>;"}, wantErr: true},
+		{gram: "main", rules: map[string]string{"<main>": "say \"<lib.quant>\";"}, wantErr: false},
+		{gram: "main", rules: map[string]string{"<main>": "<quant>;"}, wantErr: false},
+		{gram: "main", rules: map[string]string{"<main>": "<lib2.quant>;"}, wantErr: false},
+		{gram: "main", rules: map[string]string{"<main>": "<quant>;", "<quant>": "some;"}, wantErr: false},
+		{gram: "main", rules: map[string]string{"<main>": "<NULL> <VOID>;"}, wantErr: false},
+		{gram: "main", rules: map[string]string{"<main>": "<other.rule> <rule>;"}, wantErr: false},
+		{gram: "lib", rules: grams["lib"], wantErr: false},
+		{gram: "lib2", rules: map[string]string{"<main>": "<lib.quant>;"}, wantErr: true},
+	}
+	for i, test := range table {
+		err := validateVisibility("main.jsgf", test.gram, test.rules, nil, grams, public, lexer)
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: validateVisibility(%v, %v).err\nGOT %v\nWANT %v", i, test.gram, test.rules, err, test.wantErr)
+		}
+		if err != nil && (!strings.Contains(err.Error(), "main.jsgf") || !strings.Contains(err.Error(), "<lib.quant>")) {
+			t.Errorf("test %v: validateVisibility(%v, %v).err\nGOT %v\nWANT file and rule in error", i, test.gram, test.rules, err)
+		}
 	}
 }
 
@@ -263,12 +495,14 @@ func TestPeekGrammar(t *testing.T) {
 		p       string
 		n       string
 		imports []string
+		public  []string
 		rules   map[string]string
 	}{
 		{
 			p:       "data/tests/test0.jsgf",
 			n:       "test0",
-			imports: []string{"import <a.*>;"},
+			imports: []string{"import <a.request>;", "import <a.order>;"},
+			public:  []string{"<main>"},
 			rules: map[string]string{
 				"<main>":    "(<request>|<order>) <quant> <teatype> tea;",
 				"<quant>":   "some|a (cup|glass) of;",
@@ -279,7 +513,8 @@ func TestPeekGrammar(t *testing.T) {
 		{
 			p:       "data/tests/test0.jjsgf",
 			n:       "test0",
-			imports: []string{"import <a.*>;"},
+			imports: []string{"import <a.request>;", "import <a.order>;"},
+			public:  []string{"<main>"},
 			rules: map[string]string{
 				"<main>":    "(<request>|<order>) <quant> <teatype> tea;",
 				"<quant>":   "some|a (cup|glass) of;",
@@ -291,6 +526,7 @@ func TestPeekGrammar(t *testing.T) {
 			p:       "data/tests/test1.jsgf",
 			n:       "test1",
 			imports: []string{"import <c.brew>;"},
+			public:  []string{"<main>"},
 			rules: map[string]string{
 				"<main>":    "(<request>|<order>) <quant> <teatype> tea;",
 				"<request>": "[(could|will|would) you] please <brew>;",
@@ -303,6 +539,7 @@ func TestPeekGrammar(t *testing.T) {
 			p:       "data/tests/test2.jsgf",
 			n:       "test2",
 			imports: []string{"import <a1.*>;"},
+			public:  []string{"<main>"},
 			rules: map[string]string{
 				"<main>":    "(<request>|<order>) <quant> <teatype> tea;",
 				"<request>": "[(could|will|would) you] please <brew>;",
@@ -316,6 +553,7 @@ func TestPeekGrammar(t *testing.T) {
 			p:       "data/tests/test3.jsgf",
 			n:       "test3",
 			imports: []string{"import <e.dne>;"},
+			public:  []string{"<main>"},
 			rules: map[string]string{
 				"<main>":    "(<request>|<order>) <quant> <teatype> tea;",
 				"<request>": "[(could|will|would) you] please <brew>;",
@@ -329,6 +567,7 @@ func TestPeekGrammar(t *testing.T) {
 			p:       "data/tests/test4.jsgf",
 			n:       "test4",
 			imports: []string{"import <d.*>;"},
+			public:  []string{"<main>"},
 			rules: map[string]string{"<main>": "(<request>|<order>) <quant> <teatype> tea;",
 				"<request>": "[(could|will|would) you] please <brew>;",
 				"<quant>":   "some|a (cup|glass) of;",
@@ -338,6 +577,7 @@ func TestPeekGrammar(t *testing.T) {
 			p:       "data/tests/test5.jsgf",
 			n:       "test5",
 			imports: []string{"import <b.request>;"},
+			public:  []string{"<main>"},
 			rules: map[string]string{"<main>": "(<request>|<order>) <quant> <teatype> tea;",
 				"<order>":   "i'd like [to order|a|<quant>];",
 				"<quant>":   "some|a (cup|glass) of;",
@@ -348,6 +588,7 @@ func TestPeekGrammar(t *testing.T) {
 			p:       "data/tests/a.jsgf",
 			n:       "a",
 			imports: []string{},
+			public:  []string{},
 			rules: map[string]string{"<request>": "[(could|will|would) you] please <brew>;",
 				"<order>": "i'd like [to order|a|<quant>];",
 				"<brew>":  "(make|brew|whip up) <quant>;",
@@ -357,6 +598,7 @@ func TestPeekGrammar(t *testing.T) {
 			p:       "data/tests/a.jjsgf",
 			n:       "a",
 			imports: []string{},
+			public:  []string{},
 			rules: map[string]string{"<request>": "[(could|will|would) you] please <brew>;",
 				"<order>": "i'd like [to order|a|<quant>];",
 				"<brew>":  "(make|brew|whip up) <quant>;",
@@ -366,6 +608,7 @@ func TestPeekGrammar(t *testing.T) {
 			p:       "data/tests/b.jsgf",
 			n:       "b",
 			imports: []string{"import <c.brew>;"},
+			public:  []string{},
 			rules: map[string]string{"<request>": "[(could|will|would) you] please <brew>;",
 				"<order>": "i'd like [to order|a|<quant>];",
 				"<quant>": "some|a (cup|glass) of;"},
@@ -374,6 +617,7 @@ func TestPeekGrammar(t *testing.T) {
 			p:       "data/tests/dir0/c.jsgf",
 			n:       "c",
 			imports: []string{},
+			public:  []string{},
 			rules: map[string]string{"<teatype>": "red|sweet|green|jasmine|milk;",
 				"<brew>":  "(make|brew|whip up) <quant>;",
 				"<quant>": "some|a (cup|glass) of;"},
@@ -389,6 +633,7 @@ func TestPeekGrammar(t *testing.T) {
 			p:       "data/tests/dir0/dir1/dir2/e.jsgf",
 			n:       "e",
 			imports: []string{},
+			public:  []string{"<main>"},
 			rules: map[string]string{
 				"<main>":    "(<request>|<order>) <quant> <teatype> tea;",
 				"<request>": "[(could|will|would) you] please <brew>;",
@@ -402,6 +647,7 @@ func TestPeekGrammar(t *testing.T) {
 			p:       "data/tests/dir0/dir1/dir2/e.jjsgf",
 			n:       "e",
 			imports: []string{},
+			public:  []string{"<main>"},
 			rules: map[string]string{
 				"<main>":    "(<request>|<order>) <quant> <teatype> tea;",
 				"<request>": "[(could|will|would) you] please <brew>;",
@@ -413,7 +659,8 @@ func TestPeekGrammar(t *testing.T) {
 		},
 	}
 	for i, test := range table {
-		name, imports, rules, err := peekGrammar(test.p)
+		peek, err := peekGrammar(os.DirFS("."), test.p, "\"")
+		name, imports, rules, public := peek.name, peek.imports, peek.rules, peek.public
 		if err != nil {
 			t.Errorf("test %v: PeekGrammar(%v)\nGOT error %v", i, test.p, err)
 		}
@@ -425,6 +672,11 @@ func TestPeekGrammar(t *testing.T) {
 		if !slices.Equal(imports, test.imports) {
 			t.Errorf("test %v: PeekGrammar(%v)imports\nGOT %v\nWANT %v", i, test.p, imports, test.imports)
 		}
+		sort.Strings(public)
+		sort.Strings(test.public)
+		if !slices.Equal(public, test.public) {
+			t.Errorf("test %v: PeekGrammar(%v).public\nGOT %v\nWANT %v", i, test.p, public, test.public)
+		}
 		if len(rules) != len(test.rules) {
 			t.Errorf("test %v: PeekGrammar(%v).rules\nGOT %v\nWANT %v", i, test.p, rules, test.rules)
 		}
@@ -462,6 +714,56 @@ func TestCleanImportStatement(t *testing.T) {
 	}
 }
 
+func TestSplitImport(t *testing.T) {
+	grams := []string{"a", "com.acme.food.tea", "x.y", "x"}
+	isGrammar := func(g string) bool { return slices.Contains(grams, g) }
+	tests := []struct {
+		s    string
+		gram string
+		rule string
+	}{
+		{s: "", gram: "", rule: ""},
+		{s: "a", gram: "a", rule: ""},
+		{s: "a.*", gram: "a", rule: "*"},
+		{s: "a.rule", gram: "a", rule: "rule"},
+		{s: "com.acme.food.tea.*", gram: "com.acme.food.tea", rule: "*"},
+		{s: "com.acme.food.tea.drink", gram: "com.acme.food.tea", rule: "drink"},
+		{s: "com.acme.food.tea", gram: "com.acme.food.tea", rule: ""},
+		{s: "com.acme.food.dne", gram: "com.acme.food", rule: "dne"},
+		{s: "x.y", gram: "x", rule: "y"},
+		{s: "x.y.z", gram: "x.y", rule: "z"},
+		{s: "dne", gram: "dne", rule: ""},
+	}
+	for i, test := range tests {
+		gram, rule := splitImport(test.s, isGrammar)
+		if gram != test.gram || rule != test.rule {
+			t.Errorf("test %v: splitImport(%v)\nGOT %v, %v\nWANT %v, %v", i, test.s, gram, rule, test.gram, test.rule)
+		}
+	}
+}
+
+func TestUnqualifyReferences(t *testing.T) {
+	lexer := NewJSGFLexer("\"")
+	tests := []struct {
+		s    string
+		gram string
+		want string
+	}{
+		{s: "", gram: "a", want: ""},
+		{s: "<a.b> <b> <c.b>", gram: "a", want: "<b> <b> <c.b>"},
+		{s: "<com.acme.tea.b> <tea.c> <acme.tea.d> <coffee.e>", gram: "com.acme.tea", want: "<b> <c> <acme.tea.d> <coffee.e>"},
+		{s: "<tea.b>", gram: "tea", want: "<b>"},
+		{s: "say \"<a.b>\" <a.b>;", gram: "a", want: "say \"<a.b>\" <b>;"},
+		{s: "\"<tea.b>\" [and <tea.b>];", gram: "com.acme.tea", want: "\"<tea.b>\" [and <b>];"},
+	}
+	for i, test := range tests {
+		got := unqualifyReferences(test.s, test.gram, lexer)
+		if got != test.want {
+			t.Errorf("test %v: unqualifyReferences(%v, %v)\nGOT %v\nWANT %v", i, test.s, test.gram, got, test.want)
+		}
+	}
+}
+
 func TestCleanGrammarStatement(t *testing.T) {
 	tests := []struct {
 		s    string
@@ -484,6 +786,49 @@ func TestCleanGrammarStatement(t *testing.T) {
 	}
 }
 
+func TestCleanHeaderStatement(t *testing.T) {
+	tests := []struct {
+		s       string
+		version string
+		charset string
+		locale  string
+	}{
+		{s: "", version: "", charset: "", locale: ""},
+		{s: "#JSGF;", version: "", charset: "", locale: ""},
+		{s: "#JSGF V1.0;", version: "V1.0", charset: "", locale: ""},
+		{s: "#JSGF V1.0 UTF-8;", version: "V1.0", charset: "UTF-8", locale: ""},
+		{s: "#JSGF V1.0 ISO8859-1 en;", version: "V1.0", charset: "ISO8859-1", locale: "en"},
+		{s: "  #JSGF  V1.0  ISO8859-1  en;  ", version: "V1.0", charset: "ISO8859-1", locale: "en"},
+	}
+	for i, test := range tests {
+		version, charset, locale := cleanHeaderStatement(test.s)
+		if version != test.version || charset != test.charset || locale != test.locale {
+			t.Errorf("test %v: cleanHeaderStatement(%v)\nGOT %v %v %v\nWANT %v %v %v", i, test.s, version, charset, locale, test.version, test.charset, test.locale)
+		}
+	}
+}
+
+func TestValidateJSGFHeader(t *testing.T) {
+	tests := []struct {
+		s       string
+		wantErr bool
+	}{
+		{s: "", wantErr: true},
+		{s: "#JSGF;", wantErr: true},
+		{s: "#JSGF V1.0", wantErr: true},
+		{s: "#JSGF 1.0;", wantErr: true},
+		{s: "#JSGF V1.0;", wantErr: false},
+		{s: "#JSGF V1.0 UTF-8;", wantErr: false},
+		{s: "#JSGF V1.0 ISO8859-1 en;", wantErr: false},
+		{s: "#JSGF V1.0 ISO8859-1 en extra;", wantErr: true},
+	}
+	for i, test := range tests {
+		if err := ValidateJSGFHeader(test.s); (err != nil) != test.wantErr {
+			t.Errorf("test %v: ValidateJSGFHeader(%v).err\nGOT %v\nWANT %v", i, test.s, err, test.wantErr)
+		}
+	}
+}
+
 func TestValidateJSGFName(t *testing.T) {
 	tests := []struct {
 		s       string
@@ -3,7 +3,7 @@
 // Created on Fri Mar 14 09:33:35 PM EDT 2025
 // author: Ryan Hildebrandt, github.com/ryancahildebrandt
 
-package main
+package gsgf
 
 import (
 	"fmt"
@@ -3,13 +3,17 @@
 // Created on Sat Aug 24 01:56:01 PM EDT 2024
 // author: Ryan Hildebrandt, github.com/ryancahildebrandt
 
-package main
+package gsgf
 
 import (
+	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/bzick/tokenizer"
 )
@@ -34,17 +38,24 @@ const (
 	SingleQuote
 	BackSlash
 	ForwardSlash
+	KleeneStar
+	KleenePlus
 )
 
 // Tokens that can be ignored during graph traversal and production collection
-var jsgfFilter []string = []string{"(", ")", "[", "]", "<SOS>", ";", "|", "<EOS>", ""}
+var jsgfFilter []string = []string{"(", ")", "[", "]", "<SOS>", ";", "|", "*", "+", "<EOS>", ""}
 
 // Returns a tokenizer for jsgf files with the specified quote token
+// Quotes are read as tokens of their own, and only start a literal at the start of a token, see ToTokenSpans
 func NewJSGFLexer(q string) *tokenizer.Tokenizer {
 	var lexer *tokenizer.Tokenizer = tokenizer.New()
 
-	if q != "" {
-		lexer.DefineStringToken(DoubleQuote, `"`, `"`).SetEscapeSymbol(BackSlash).AddSpecialStrings(tokenizer.DefaultSpecialString)
+	switch q {
+	case "":
+	case "'":
+		lexer.DefineTokens(SingleQuote, []string{q})
+	default:
+		lexer.DefineTokens(DoubleQuote, []string{q})
 	}
 
 	lexer.SetWhiteSpaces([]byte{})
@@ -65,10 +76,66 @@ func NewJSGFLexer(q string) *tokenizer.Tokenizer {
 	lexer.DefineTokens(SequenceEnd, []string{"<EOS>"})
 	lexer.DefineTokens(BackSlash, []string{"\\"})
 	lexer.DefineTokens(ForwardSlash, []string{"/"})
+	lexer.DefineTokens(KleeneStar, []string{"*"})
+	lexer.DefineTokens(KleenePlus, []string{"+"})
 
 	return lexer
 }
 
+// Returns the quote character of the quote token defined for the lexer, or an empty string if none is defined
+func getQuoteChar(lex *tokenizer.Tokenizer) string {
+	for _, q := range []string{`"`, "'"} {
+		if lex.ParseString(q).CurrentToken().Is(DoubleQuote, SingleQuote) {
+			return q
+		}
+	}
+
+	return ""
+}
+
+// Checks if r can be part of a word, so that a quote following it, as in i'd, is read as text rather than the start of a literal
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Checks if the quote q at byte offset i of s is at the start of a token, where it can start a literal, see quotedLength
+func opensQuote(s string, i int, q string) bool {
+	if q == "" || !strings.HasPrefix(s[i:], q) {
+		return false
+	}
+	r, _ := utf8.DecodeLastRuneInString(s[:i])
+
+	return i == 0 || !isWordRune(r)
+}
+
+// Returns the length in bytes of the literal quoted with q at the start of s, including both quotes, or -1 if the literal is not closed before the end of s or of its line
+// Quotes escaped with \ do not close the literal
+func quotedLength(s string, q string) int {
+	if q == "" || !strings.HasPrefix(s, q) {
+		return -1
+	}
+	for i := len(q); i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case s[i] == '\n':
+			return -1
+		case strings.HasPrefix(s[i:], q):
+			return i + len(q)
+		}
+	}
+
+	return -1
+}
+
+// Returns the contents of a quoted literal, removing the surrounding quotes q and unescaping \q and \\
+func unquoteLiteral(s string, q string) string {
+	s = strings.TrimPrefix(s, q)
+	s = strings.TrimSuffix(s, q)
+
+	return strings.NewReplacer(`\\`, `\`, `\`+q, q).Replace(s)
+}
+
 // Returns a string beginning from s.CurrentToken and ending at the first occurrence of the ending string, optionally including the end token in the returned string
 func captureString(s *tokenizer.Stream, end string, includeEnd bool) (string, error) {
 	var builder strings.Builder
@@ -106,3 +173,169 @@ func ValidateLexerString(s string) error {
 
 	return nil
 }
+
+// Contains a single jsgf statement terminated by ;, along with the doc comment preceding it and the position of each byte of the statement in the source
+type statement struct {
+	text string
+	doc  string
+	pos  []Position
+}
+
+// Returns the text of the statement along with the position of each of its bytes
+func (st statement) source() source {
+	return source{text: st.text, pos: st.pos}
+}
+
+// Reads all lines from s and splits them into jsgf statements
+// - Lines are joined with a single space until the closing ; of each statement
+// - Line comments // and block comments /* */ outside of strings quoted with q and tags are removed
+// - A quote q only starts a quoted string at the start of a token and if it is closed on the same line, so apostrophes as in i'd and unclosed quotes do not run past the end of the statement
+// - Doc comments /** */ are attached to the statement that follows them
+// - Each byte of a statement keeps the line and column it was read from, with joining spaces placed at the end of the line they replace
+// Returns an error if s cannot be read or a block comment is not closed
+func readStatements(s *bufio.Scanner, q string) ([]statement, error) {
+	var (
+		lines   []string
+		builder strings.Builder
+		pos     []Position
+		doc     string
+		res     []statement
+		inQuote bool
+		inTag   bool
+	)
+
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	if s.Err() != nil {
+		return []statement{}, fmt.Errorf("in readStatements(%v):\n%+w", q, s.Err())
+	}
+
+	src := []rune(strings.Join(lines, "\n"))
+	srcPos := runePositions(src)
+	write := func(i int) {
+		builder.WriteRune(src[i])
+		for range utf8.RuneLen(src[i]) {
+			pos = append(pos, srcPos[i])
+		}
+	}
+	flush := func() {
+		text := builder.String()
+		start := len(text) - len(strings.TrimLeft(text, " \t"))
+		end := max(len(strings.TrimRight(text, " \t")), start)
+		res = append(res, statement{text: text[start:end], doc: doc, pos: pos[start:end]})
+		builder.Reset()
+		pos = []Position{}
+	}
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '\\' && i+1 < len(src):
+			write(i)
+			write(i + 1)
+			i++
+		case inQuote:
+			write(i)
+			inQuote = string(c) != q
+		case inTag:
+			write(i)
+			inTag = c != '}'
+		case q != "" && string(c) == q && (i == 0 || !isWordRune(src[i-1])) && quotedLength(string(src[i:lineEnd(src, i)]), q) > 0:
+			write(i)
+			inQuote = true
+		case c == '{':
+			write(i)
+			inTag = true
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i+1 < len(src) && src[i+1] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := i + 2
+			for end+1 < len(src) && (src[end] != '*' || src[end+1] != '/') {
+				end++
+			}
+			if end+1 >= len(src) {
+				return res, fmt.Errorf("error when calling readStatements(%v):\n%+w", q, &SourceError{Pos: srcPos[i], Text: "/*", Err: ErrUnclosedComment})
+			}
+			if src[i+2] == '*' && end > i+2 {
+				doc = cleanDocComment(string(src[i+3 : end]))
+			}
+			i = end + 1
+		case c == '\n':
+			line := strings.TrimRight(builder.String(), " \t")
+			builder.Reset()
+			builder.WriteString(line)
+			pos = pos[:len(line)]
+			if line != "" {
+				builder.WriteRune(' ')
+				pos = append(pos, srcPos[i])
+			}
+			for i+1 < len(src) && (src[i+1] == ' ' || src[i+1] == '\t') {
+				i++
+			}
+		case c == ';':
+			write(i)
+			flush()
+			doc = ""
+		default:
+			write(i)
+		}
+	}
+	if strings.TrimSpace(builder.String()) != "" {
+		flush()
+	}
+
+	return res, nil
+}
+
+// Checks if a statement read by readStatements has no content other than its closing semicolon
+func isEmptyStatement(s string) bool {
+	return strings.TrimSpace(strings.TrimSuffix(s, ";")) == ""
+}
+
+// Returns the index of the line break ending the line of src that index i is on, or the length of src if it is on the last line
+func lineEnd(src []rune, i int) int {
+	n := slices.Index(src[i:], '\n')
+	if n < 0 {
+		return len(src)
+	}
+
+	return i + n
+}
+
+// Returns the line and column of each rune in src, counting from 1
+func runePositions(src []rune) []Position {
+	var (
+		res  []Position = make([]Position, len(src))
+		line int        = 1
+		col  int        = 1
+	)
+
+	for i, c := range src {
+		res[i] = Position{Line: line, Column: col}
+		col++
+		if c == '\n' {
+			line++
+			col = 1
+		}
+	}
+
+	return res
+}
+
+// Returns the contents of a doc comment, with leading * and surrounding whitespace removed from each line
+func cleanDocComment(s string) string {
+	var lines []string
+
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		line = strings.TrimPrefix(line, "*")
+		line = strings.TrimSpace(line)
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
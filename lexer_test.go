@@ -3,9 +3,11 @@
 // Created on Mon Dec 30 05:00:58 PM EST 2024
 // author: Ryan Hildebrandt, github.com/ryancahildebrandt
 
-package main
+package gsgf
 
 import (
+	"bufio"
+	"strings"
 	"testing"
 )
 
@@ -62,3 +64,122 @@ func TestValidateLexerString(t *testing.T) {
 		}
 	}
 }
+
+func TestReadStatements(t *testing.T) {
+	table := []struct {
+		s       string
+		q       string
+		want    []statement
+		wantErr bool
+	}{
+		{s: "", q: "\"", want: []statement{}, wantErr: false},
+		{s: "<a> = b;", q: "\"", want: []statement{{text: "<a> = b;"}}, wantErr: false},
+		{s: "<a> = b;<c> = d;", q: "\"", want: []statement{{text: "<a> = b;"}, {text: "<c> = d;"}}, wantErr: false},
+		{s: "<a> = b\n\t| c\n\t| d;", q: "\"", want: []statement{{text: "<a> = b | c | d;"}}, wantErr: false},
+		{s: "<a> =\n  b;", q: "\"", want: []statement{{text: "<a> = b;"}}, wantErr: false},
+		{s: "<a> = b; // comment", q: "\"", want: []statement{{text: "<a> = b;"}}, wantErr: false},
+		{s: "// comment\n<a> = b;", q: "\"", want: []statement{{text: "<a> = b;"}}, wantErr: false},
+		{s: "<a> = b // comment\n c;", q: "\"", want: []statement{{text: "<a> = b c;"}}, wantErr: false},
+		{s: "<a> = b /* comment */c;", q: "\"", want: []statement{{text: "<a> = b c;"}}, wantErr: false},
+		{s: "/* comment\n; */<a> = b;", q: "\"", want: []statement{{text: "<a> = b;"}}, wantErr: false},
+		{s: "/**/<a> = b;", q: "\"", want: []statement{{text: "<a> = b;"}}, wantErr: false},
+		{s: "/** doc */\n<a> = b;<c> = d;", q: "\"", want: []statement{{text: "<a> = b;", doc: "doc"}, {text: "<c> = d;"}}, wantErr: false},
+		{s: "/**\n * multi\n * line\n */\n<a> = b;", q: "\"", want: []statement{{text: "<a> = b;", doc: "multi\nline"}}, wantErr: false},
+		{s: "<a> = \"b // c; /* d */\";", q: "\"", want: []statement{{text: "<a> = \"b // c; /* d */\";"}}, wantErr: false},
+		{s: "<a> = b {c // d; /* e */};", q: "\"", want: []statement{{text: "<a> = b {c // d; /* e */};"}}, wantErr: false},
+		{s: "<a> = b\\;c;", q: "\"", want: []statement{{text: "<a> = b\\;c;"}}, wantErr: false},
+		{s: "<a> = b", q: "\"", want: []statement{{text: "<a> = b"}}, wantErr: false},
+		{s: "<a> = b; /* comment", q: "\"", want: []statement{{text: "<a> = b;"}}, wantErr: true},
+		{s: "<a> = 'b // c; /* d */';", q: "'", want: []statement{{text: "<a> = 'b // c; /* d */';"}}, wantErr: false},
+		{s: "<a> = 'b;' \"c;\";", q: "'", want: []statement{{text: "<a> = 'b;' \"c;"}, {text: "\";"}}, wantErr: false},
+		{s: "<a> = \"b;\";", q: "", want: []statement{{text: "<a> = \"b;"}, {text: "\";"}}, wantErr: false},
+		{s: "<a> = i'd like tea;\n<b> = 'c;d';", q: "'", want: []statement{{text: "<a> = i'd like tea;"}, {text: "<b> = 'c;d';"}}, wantErr: false},
+		{s: "<a> = say \"b | c;\n<d> = e;", q: "\"", want: []statement{{text: "<a> = say \"b | c;"}, {text: "<d> = e;"}}, wantErr: false},
+		{s: "<a> = \"b\nc\";", q: "\"", want: []statement{{text: "<a> = \"b c\";"}}, wantErr: false},
+	}
+	for i, test := range table {
+		got, err := readStatements(bufio.NewScanner(strings.NewReader(test.s)), test.q)
+		if len(got) != len(test.want) {
+			t.Errorf("test %v: readStatements(%v, %v)\nGOT %v\nWANT %v", i, test.s, test.q, got, test.want)
+		}
+		for j := range min(len(got), len(test.want)) {
+			if got[j].text != test.want[j].text || got[j].doc != test.want[j].doc {
+				t.Errorf("test %v: readStatements(%v, %v)\nGOT %v\nWANT %v", i, test.s, test.q, got, test.want)
+			}
+		}
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: readStatements(%v, %v).err\nGOT %v\nWANT %v", i, test.s, test.q, err, test.wantErr)
+		}
+	}
+}
+
+func TestReadStatementsPositions(t *testing.T) {
+	table := []struct {
+		s    string
+		i    int
+		j    int
+		want Position
+	}{
+		{s: "<a> = b;", i: 0, j: 0, want: Position{Line: 1, Column: 1}},
+		{s: "<a> = b;", i: 0, j: 6, want: Position{Line: 1, Column: 7}},
+		{s: "\n\n  <a> = b;", i: 0, j: 0, want: Position{Line: 3, Column: 3}},
+		{s: "<a> = b;<c> = d;", i: 1, j: 0, want: Position{Line: 1, Column: 9}},
+		{s: "<a> = b\n\t| c;", i: 0, j: 7, want: Position{Line: 1, Column: 8}},
+		{s: "<a> = b\n\t| c;", i: 0, j: 10, want: Position{Line: 2, Column: 4}},
+		{s: "<a> = b /* x */ c;", i: 0, j: 8, want: Position{Line: 1, Column: 16}},
+		{s: "/** doc */\n<a> = é c;", i: 0, j: 7, want: Position{Line: 2, Column: 7}},
+		{s: "/** doc */\n<a> = é c;", i: 0, j: 9, want: Position{Line: 2, Column: 9}},
+	}
+	for i, test := range table {
+		got, err := readStatements(bufio.NewScanner(strings.NewReader(test.s)), "\"")
+		if err != nil {
+			t.Errorf("test %v: readStatements(%v)\nGOT %v", i, test.s, err)
+		}
+		if len(got[test.i].pos) != len(got[test.i].text) {
+			t.Errorf("test %v: len(readStatements(%v)[%v].pos)\nGOT %v\nWANT %v", i, test.s, test.i, len(got[test.i].pos), len(got[test.i].text))
+		}
+		if got[test.i].source().position(test.j) != test.want {
+			t.Errorf("test %v: readStatements(%v)[%v].position(%v)\nGOT %v\nWANT %v", i, test.s, test.i, test.j, got[test.i].source().position(test.j), test.want)
+		}
+	}
+}
+
+func TestGetQuoteChar(t *testing.T) {
+	table := []struct {
+		q    string
+		want string
+	}{
+		{q: "", want: ""},
+		{q: "\"", want: "\""},
+		{q: "'", want: "'"},
+	}
+	for i, test := range table {
+		got := getQuoteChar(NewJSGFLexer(test.q))
+		if got != test.want {
+			t.Errorf("test %v: getQuoteChar(NewJSGFLexer(%v))\nGOT %v\nWANT %v", i, test.q, got, test.want)
+		}
+	}
+}
+
+func TestUnquoteLiteral(t *testing.T) {
+	table := []struct {
+		s    string
+		q    string
+		want string
+	}{
+		{s: "\"\"", q: "\"", want: ""},
+		{s: "\"a|b (c)\"", q: "\"", want: "a|b (c)"},
+		{s: "'x;y'", q: "'", want: "x;y"},
+		{s: "\"say \\\"hi\\\"\"", q: "\"", want: "say \"hi\""},
+		{s: "'it\\'s'", q: "'", want: "it's"},
+		{s: "'a\\\\b'", q: "'", want: "a\\b"},
+		{s: "'a\\\"b'", q: "'", want: "a\\\"b"},
+		{s: "\"a\\\\nb\"", q: "\"", want: "a\\nb"},
+	}
+	for i, test := range table {
+		got := unquoteLiteral(test.s, test.q)
+		if got != test.want {
+			t.Errorf("test %v: unquoteLiteral(%v, %v)\nGOT %v\nWANT %v", i, test.s, test.q, got, test.want)
+		}
+	}
+}
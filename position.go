@@ -0,0 +1,269 @@
+// -*- coding: utf-8 -*-
+
+// Created on Sat Oct 17 01:47:15 PM EDT 2026
+// author: Ryan Hildebrandt, github.com/ryancahildebrandt
+
+package gsgf
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Location of a character in a grammar file, with line and column numbers starting at 1
+// Columns are counted in characters rather than bytes
+type Position struct {
+	File   string
+	Line   int
+	Column int
+}
+
+// Checks if the position points to a line of a grammar file
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// Returns the position in the form file:line:col, leaving out the file name or line and column if they are not known
+func (p Position) String() string {
+	switch {
+	case !p.IsValid():
+		return p.File
+	case p.File == "":
+		return fmt.Sprintf("%v:%v", p.Line, p.Column)
+	default:
+		return fmt.Sprintf("%v:%v:%v", p.File, p.Line, p.Column)
+	}
+}
+
+// Orders positions by file name, line, and column
+func (p Position) compare(q Position) int {
+	return cmp.Or(strings.Compare(p.File, q.File), cmp.Compare(p.Line, q.Line), cmp.Compare(p.Column, q.Column))
+}
+
+// Error at a position in a grammar file, reported as file:line:col: message text
+// - Msg describes the error. If empty, the message of the innermost wrapped error is used
+// - Text is the offending statement, rule reference, or token
+// - Prev is the position of an earlier definition the error conflicts with, such as the first definition of a duplicate rule, and is reported after the text if known
+type SourceError struct {
+	Pos  Position
+	Msg  string
+	Text string
+	Prev Position
+	Err  error
+}
+
+func (e *SourceError) Error() string {
+	var msg []string
+
+	if e.Pos.String() != "" {
+		msg = append(msg, e.Pos.String()+":")
+	}
+	msg = append(msg, e.message())
+	if e.Text != "" {
+		msg = append(msg, e.Text)
+	}
+	if e.Prev.String() != "" {
+		msg = append(msg, fmt.Sprintf("(previously defined at %v)", e.Prev))
+	}
+
+	return strings.Join(msg, " ")
+}
+
+func (e *SourceError) Unwrap() error {
+	return e.Err
+}
+
+// Helper function to get the message of the error, falling back to the innermost wrapped error
+func (e *SourceError) message() string {
+	if e.Msg != "" || e.Err == nil {
+		return e.Msg
+	}
+	err := e.Err
+	for errors.Unwrap(err) != nil {
+		err = errors.Unwrap(err)
+	}
+
+	return err.Error()
+}
+
+// All errors found in a grammar, reported one per line
+// errors.Is and errors.As match against each error in the list
+type ErrorList []*SourceError
+
+func (l ErrorList) Error() string {
+	var msg []string
+
+	for _, e := range l {
+		msg = append(msg, e.Error())
+	}
+
+	return strings.Join(msg, "\n")
+}
+
+func (l ErrorList) Unwrap() []error {
+	var res []error
+
+	for _, e := range l {
+		res = append(res, e)
+	}
+
+	return res
+}
+
+// Adds err to the list, using the errors of the ErrorList or the first SourceError it wraps if there is one, or positioning it at pos otherwise
+func (l *ErrorList) add(err error, pos Position, text string) {
+	var (
+		se   *SourceError
+		errs ErrorList
+	)
+
+	switch {
+	case errors.As(err, &errs):
+		*l = append(*l, errs...)
+	case errors.As(err, &se):
+		*l = append(*l, se)
+	default:
+		*l = append(*l, &SourceError{Pos: pos, Text: text, Err: err})
+	}
+}
+
+// Sorts the errors by position, keeping errors at the same position in the order they were found
+func (l ErrorList) sort() {
+	slices.SortStableFunc(l, func(a *SourceError, b *SourceError) int { return a.Pos.compare(b.Pos) })
+}
+
+// Returns the sorted list as an error, or nil if the list is empty
+func (l ErrorList) err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	l.sort()
+
+	return l
+}
+
+// Applies f to the position of the first SourceError wrapped in err, or of every error if err wraps an ErrorList, returning err
+func updateErrorPosition(err error, f func(Position) Position) error {
+	var (
+		se   *SourceError
+		errs ErrorList
+	)
+
+	switch {
+	case errors.As(err, &errs):
+		for _, e := range errs {
+			e.Pos, e.Prev = f(e.Pos), updatePrev(e.Prev, f)
+		}
+	case errors.As(err, &se):
+		se.Pos, se.Prev = f(se.Pos), updatePrev(se.Prev, f)
+	}
+
+	return err
+}
+
+// Helper function to apply f to the previous position of an error, if it has one
+func updatePrev(p Position, f func(Position) Position) Position {
+	if p == (Position{}) {
+		return p
+	}
+
+	return f(p)
+}
+
+// Returns a function that sets the file name of positions that do not have one
+func inFile(file string) func(Position) Position {
+	return func(p Position) Position {
+		if p.File == "" {
+			p.File = file
+		}
+
+		return p
+	}
+}
+
+// Removes the line and column of a position, keeping the file name
+// Used for jjsgf grammars, where lines and columns of the converted jsgf statements do not match the json file
+func fileOnly(p Position) Position {
+	return Position{File: p.File}
+}
+
+// Applies f to the positions of all rules and rule tokens in g
+func updatePositions(g Grammar, f func(Position) Position) Grammar {
+	for k, v := range g.Rules {
+		v.pos = f(v.pos)
+		tokenPos := make([]Position, len(v.tokenPos))
+		for i, p := range v.tokenPos {
+			tokenPos[i] = f(p)
+		}
+		v.tokenPos = tokenPos
+		g.Rules[k] = v
+	}
+
+	return g
+}
+
+// Text read from a grammar file, along with the position of each of its bytes
+type source struct {
+	text string
+	pos  []Position
+}
+
+// Returns the position of byte i of the source text, or the closest position if i is out of range
+func (s source) position(i int) Position {
+	switch {
+	case len(s.pos) == 0:
+		return Position{}
+	case i < 0:
+		return s.pos[0]
+	case i >= len(s.pos):
+		return s.pos[len(s.pos)-1]
+	default:
+		return s.pos[i]
+	}
+}
+
+// Returns the source of the text from byte i up to but not including byte j
+func (s source) slice(i int, j int) source {
+	return source{text: s.text[i:j], pos: s.pos[min(i, len(s.pos)):min(j, len(s.pos))]}
+}
+
+// Applies f to the position of each byte of the source
+func (s source) update(f func(Position) Position) source {
+	pos := make([]Position, len(s.pos))
+	for i, p := range s.pos {
+		pos[i] = f(p)
+	}
+	s.pos = pos
+
+	return s
+}
+
+// Returns the source of the expansion of a rule statement, following the first =, with surrounding whitespace removed
+func ruleExpansion(st source) source {
+	i := strings.Index(st.text, "=") + 1
+	i += len(st.text[i:]) - len(strings.TrimLeft(st.text[i:], " \t"))
+	j := max(len(strings.TrimRight(st.text, " \t")), i)
+
+	return st.slice(i, j)
+}
+
+// File system rooted at a directory, used to report the paths of grammar files relative to the directory they were loaded from
+type rootedFS struct {
+	fs.FS
+	root string
+}
+
+// Returns the path of file p in fsys as reported in errors, including the root directory of fsys if it has one
+func filePath(fsys fs.FS, p string) string {
+	r, ok := fsys.(rootedFS)
+	if !ok {
+		return path.Clean(p)
+	}
+
+	return path.Join(r.root, p)
+}
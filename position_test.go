@@ -0,0 +1,157 @@
+// -*- coding: utf-8 -*-
+
+// Created on Sat Oct 17 02:31:52 PM EDT 2026
+// author: Ryan Hildebrandt, github.com/ryancahildebrandt
+
+package gsgf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestPositionString(t *testing.T) {
+	table := []struct {
+		p    Position
+		want string
+	}{
+		{p: Position{}, want: ""},
+		{p: Position{File: "a.jsgf"}, want: "a.jsgf"},
+		{p: Position{Line: 3, Column: 7}, want: "3:7"},
+		{p: Position{File: "a.jsgf", Line: 3, Column: 7}, want: "a.jsgf:3:7"},
+		{p: Position{File: "dir/a.jsgf", Line: 1, Column: 1}, want: "dir/a.jsgf:1:1"},
+	}
+	for i, test := range table {
+		got := test.p.String()
+		if got != test.want {
+			t.Errorf("test %v: %v.String()\nGOT %v\nWANT %v", i, test.p, got, test.want)
+		}
+	}
+}
+
+func TestSourceError(t *testing.T) {
+	table := []struct {
+		e    *SourceError
+		want string
+	}{
+		{e: &SourceError{Msg: "undefined rule", Text: "<a>"}, want: "undefined rule <a>"},
+		{e: &SourceError{Pos: Position{File: "a.jsgf", Line: 7, Column: 18}, Msg: "undefined rule", Text: "<quant>"}, want: "a.jsgf:7:18: undefined rule <quant>"},
+		{e: &SourceError{Pos: Position{File: "a.jsgf"}, Msg: "undefined rule", Text: "<quant>"}, want: "a.jsgf: undefined rule <quant>"},
+		{e: &SourceError{Pos: Position{Line: 1, Column: 2}, Text: "<a>", Err: fmt.Errorf("in f():\n%+w", errors.New("root cause"))}, want: "1:2: root cause <a>"},
+		{e: &SourceError{Pos: Position{Line: 1, Column: 2}, Msg: "message", Err: errors.New("root cause")}, want: "1:2: message"},
+		{e: &SourceError{Pos: Position{File: "a.jsgf", Line: 6, Column: 1}, Text: "<a>", Prev: Position{File: "a.jsgf", Line: 2, Column: 1}, Err: ErrDuplicateRule}, want: "a.jsgf:6:1: duplicate rule definition <a> (previously defined at a.jsgf:2:1)"},
+		{e: &SourceError{Pos: Position{File: "a.jjsgf"}, Text: "<a>", Prev: Position{File: "b.jjsgf"}, Err: ErrDuplicateRule}, want: "a.jjsgf: duplicate rule definition <a> (previously defined at b.jjsgf)"},
+	}
+	for i, test := range table {
+		got := test.e.Error()
+		if got != test.want {
+			t.Errorf("test %v: %v.Error()\nGOT %v\nWANT %v", i, test.e, got, test.want)
+		}
+		if test.e.Err != nil && !errors.Is(test.e, test.e.Err) {
+			t.Errorf("test %v: errors.Is(%v, %v)\nGOT false\nWANT true", i, test.e, test.e.Err)
+		}
+	}
+}
+
+func TestErrorList(t *testing.T) {
+	table := []struct {
+		errs ErrorList
+		want string
+	}{
+		{errs: ErrorList{}, want: ""},
+		{errs: ErrorList{{Pos: Position{Line: 1, Column: 1}, Text: "<a> b;", Err: ErrInvalidRule}}, want: "1:1: invalid jsgf rule <a> b;"},
+		{
+			errs: ErrorList{
+				{Pos: Position{File: "a.jsgf", Line: 4, Column: 2}, Text: "<b>", Err: ErrUndefinedRule},
+				{Pos: Position{File: "a.jsgf", Line: 2, Column: 9}, Text: "<c>", Err: ErrDuplicateRule},
+				{Pos: Position{File: "a.jsgf", Line: 2, Column: 1}, Text: "/x/", Err: ErrInvalidWeight},
+			},
+			want: "a.jsgf:2:1: invalid weight /x/\na.jsgf:2:9: duplicate rule definition <c>\na.jsgf:4:2: undefined rule <b>",
+		},
+		{
+			errs: ErrorList{
+				{Pos: Position{File: "b.jsgf", Line: 1, Column: 1}, Text: "<b>", Err: ErrUndefinedRule},
+				{Pos: Position{File: "a.jsgf", Line: 3, Column: 1}, Text: "<a>", Err: ErrUndefinedRule},
+				{Pos: Position{File: "a.jsgf", Line: 3, Column: 1}, Text: "<c>", Err: ErrUndefinedRule},
+			},
+			want: "a.jsgf:3:1: undefined rule <a>\na.jsgf:3:1: undefined rule <c>\nb.jsgf:1:1: undefined rule <b>",
+		},
+	}
+	for i, test := range table {
+		err := test.errs.err()
+		if (err == nil) != (len(test.errs) == 0) {
+			t.Errorf("test %v: %v.err()\nGOT %v\nWANT nil: %v", i, test.errs, err, len(test.errs) == 0)
+			continue
+		}
+		if err == nil {
+			continue
+		}
+		if err.Error() != test.want {
+			t.Errorf("test %v: %v.err()\nGOT %v\nWANT %v", i, test.errs, err.Error(), test.want)
+		}
+		for _, e := range test.errs {
+			if !errors.Is(err, e.Err) {
+				t.Errorf("test %v: errors.Is(%v, %v)\nGOT false\nWANT true", i, err, e.Err)
+			}
+		}
+	}
+}
+
+func TestUpdateErrorPosition(t *testing.T) {
+	table := []struct {
+		err  error
+		f    func(Position) Position
+		want string
+	}{
+		{err: errors.New("a"), f: inFile("a.jsgf"), want: "a"},
+		{err: fmt.Errorf("in f():\n%+w", &SourceError{Pos: Position{Line: 1, Column: 2}, Msg: "a"}), f: inFile("a.jsgf"), want: "a.jsgf:1:2: a"},
+		{err: &SourceError{Pos: Position{File: "b.jsgf", Line: 1, Column: 2}, Msg: "a"}, f: inFile("a.jsgf"), want: "b.jsgf:1:2: a"},
+		{err: &SourceError{Pos: Position{File: "b.jjsgf", Line: 1, Column: 2}, Msg: "a"}, f: fileOnly, want: "b.jjsgf: a"},
+		{err: &SourceError{Pos: Position{Line: 3, Column: 1}, Msg: "a", Prev: Position{Line: 1, Column: 1}}, f: inFile("a.jsgf"), want: "a.jsgf:3:1: a (previously defined at a.jsgf:1:1)"},
+		{err: fmt.Errorf("in f():\n%+w", ErrorList{{Pos: Position{Line: 1, Column: 2}, Msg: "a"}, {Pos: Position{Line: 3, Column: 4}, Msg: "b"}}), f: inFile("a.jsgf"), want: "a.jsgf:1:2: a\na.jsgf:3:4: b"},
+	}
+	for i, test := range table {
+		var (
+			se   *SourceError
+			errs ErrorList
+		)
+
+		err := updateErrorPosition(test.err, test.f)
+		got := err.Error()
+		switch {
+		case errors.As(err, &errs):
+			got = errs.Error()
+		case errors.As(err, &se):
+			got = se.Error()
+		}
+		if got != test.want {
+			t.Errorf("test %v: updateErrorPosition(%v)\nGOT %v\nWANT %v", i, test.err, got, test.want)
+		}
+	}
+}
+
+func TestRuleExpansion(t *testing.T) {
+	table := []struct {
+		s    string
+		want string
+		col  int
+	}{
+		{s: "<a> = b c;", want: "b c;", col: 7},
+		{s: "public <a>=b;", want: "b;", col: 12},
+		{s: "<a> =   b ;  ", want: "b ;", col: 9},
+		{s: "<a> = ;", want: ";", col: 7},
+	}
+	for i, test := range table {
+		st, _ := readStatements(bufio.NewScanner(strings.NewReader(test.s)), "\"")
+		got := ruleExpansion(st[0].source())
+		if got.text != test.want {
+			t.Errorf("test %v: ruleExpansion(%v).text\nGOT %q\nWANT %q", i, test.s, got.text, test.want)
+		}
+		if got.position(0).Column != test.col {
+			t.Errorf("test %v: ruleExpansion(%v).position(0)\nGOT %v\nWANT %v", i, test.s, got.position(0).Column, test.col)
+		}
+	}
+}
@@ -3,7 +3,7 @@
 // Created on Wed Mar  5 11:33:38 AM EST 2025
 // author: Ryan Hildebrandt, github.com/ryancahildebrandt
 
-package main
+package gsgf
 
 import (
 	"slices"
@@ -0,0 +1,151 @@
+// -*- coding: utf-8 -*-
+
+// Created on Sat Oct 17 06:12:07 PM EDT 2026
+// author: Ryan Hildebrandt, github.com/ryancahildebrandt
+
+package gsgf
+
+import (
+	"encoding/binary"
+	"iter"
+	"maps"
+	"math/big"
+	"slices"
+	"strings"
+)
+
+// Returns the path of the i-th production of the counted rule, in the order productions are yielded by ruleProductions, along with the index of the next child to visit at each node of the path, see pathsFrom
+// Each step moves to the first child whose productions include index i, skipping the productions of the children before it
+// Returns false if i is out of range
+func (p productionCounter) seek(i *big.Int) (Path, []int, bool) {
+	var (
+		path   Path  = Path{p.from}
+		next   []int = []int{0}
+		visits []int
+		empty  bool
+		node   int = p.from
+	)
+
+	if i.Sign() < 0 || i.Cmp(p.total()) >= 0 {
+		return path, next, false
+	}
+	i = new(big.Int).Set(i)
+	visits, _ = p.all.enter(p.from)
+	empty = p.tokens[p.from] == ""
+	for node != p.all.to {
+		found := false
+		for j, n := range p.all.g.getFrom(node) {
+			v, ok := p.all.move(node, visits, n)
+			if !ok {
+				continue
+			}
+			k := p.completions(n, v, empty)
+			if i.Cmp(k) >= 0 {
+				i.Sub(i, k)
+				continue
+			}
+			next[len(next)-1] = j + 1
+			path, next = append(path, n), append(next, 0)
+			node, visits, empty, found = n, v, empty && p.tokens[n] == "", true
+			break
+		}
+		if !found {
+			return path, next, false
+		}
+	}
+
+	return path, next, true
+}
+
+// Returns the index of the first production of the counted rule equal to s, in the order productions are yielded by ruleProductions
+// Paths are searched depth first, only following tokens that continue a prefix of s, and the productions of each child skipped along the way are added to the index
+// The productions skipped from each state that does not lead to s are kept, so that each state is only searched once, as ambiguous alternatives can reach the same state through many paths
+// Returns false if no path of the rule produces s
+func (p productionCounter) index(s string) (*big.Int, bool) {
+	var (
+		failed map[string]*big.Int = make(map[string]*big.Int)
+		search func(node int, visits []int, matched int, empty bool) (*big.Int, bool)
+	)
+
+	search = func(node int, visits []int, matched int, empty bool) (*big.Int, bool) {
+		var res *big.Int = new(big.Int)
+
+		if node == p.all.to {
+			return res, matched == len(s)
+		}
+		key := searchKey(node, visits, matched, empty)
+		skipped, ok := failed[key]
+		if ok {
+			return skipped, false
+		}
+		for _, n := range p.all.g.getFrom(node) {
+			v, ok := p.all.move(node, visits, n)
+			if !ok {
+				continue
+			}
+			t := p.tokens[n]
+			if matched > 0 && p.all.loops.repeats(node, n) {
+				t = repeatSeparator + t
+			}
+			if strings.HasPrefix(s[matched:], t) {
+				i, ok := search(n, v, matched+len(t), empty && p.tokens[n] == "")
+				if ok {
+					return res.Add(res, i), true
+				}
+			}
+			res.Add(res, p.completions(n, v, empty))
+		}
+		failed[key] = res
+
+		return res, false
+	}
+
+	if s == "" || p.from >= len(p.tokens) || !strings.HasPrefix(s, p.tokens[p.from]) {
+		return new(big.Int), false
+	}
+	visits, ok := p.all.enter(p.from)
+	if !ok {
+		return new(big.Int), false
+	}
+
+	return search(p.from, visits, len(p.tokens[p.from]), p.tokens[p.from] == "")
+}
+
+// Yields productions for each public rule in the grammar in the same order as AllProductions, starting from the production at index i
+// Productions before index i are skipped without generating them, by counting the productions of each rule and seeking to index i within the rule that contains it
+func productionsFrom(g Grammar, n int, i *big.Int) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		i := new(big.Int).Set(i)
+		for _, k := range slices.Sorted(maps.Keys(g.Rules)) {
+			if !g.Rules[k].IsPublic {
+				continue
+			}
+			prods := ruleProductions(g.Rules[k], n)
+			if i.Sign() > 0 {
+				c := newProductionCounter(g.Rules[k], n)
+				path, next, ok := c.seek(i)
+				if !ok {
+					i.Sub(i, c.total())
+					continue
+				}
+				prods = ruleProductionsFrom(g.Rules[k], n, path, next)
+				i.SetInt64(0)
+			}
+			for prod := range prods {
+				if !yield(prod) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Helper function to key a state of productionCounter.index by node, iterations of the loops of the graph, length of the matched prefix, and whether every token so far is empty
+func searchKey(node int, visits []int, matched int, empty bool) string {
+	key := binary.AppendUvarint([]byte(walkKey(node, visits)), uint64(matched))
+	if empty {
+		key = append(key, 1)
+	}
+
+	return string(key)
+}
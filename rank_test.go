@@ -0,0 +1,173 @@
+// -*- coding: utf-8 -*-
+
+// Created on Sat Oct 17 06:12:11 PM EDT 2026
+// author: Ryan Hildebrandt, github.com/ryancahildebrandt
+
+package gsgf
+
+import (
+	"errors"
+	"maps"
+	"math/big"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestProductionAt(t *testing.T) {
+	table := []struct {
+		s        string
+		minimize bool
+	}{
+		{s: "grammar a;\npublic <a> = one;", minimize: false},
+		{s: "grammar a;\npublic <a> = (one | two) [three];\npublic <b> = x | y | ;", minimize: false},
+		{s: "grammar a;\npublic <a> = (one | two) [three];\npublic <b> = x | y | ;", minimize: true},
+		{s: "grammar a;\npublic <a> = a* b+ [c]*;", minimize: false},
+		{s: "grammar a;\npublic <a> = (x | y (z | w)* | [v])+ end;", minimize: true},
+		{s: "grammar a;\npublic <a> = <b>* and <b>;\n<b> = one | two | <NULL>;", minimize: false},
+		{s: "grammar a;\npublic <a> = <b> | <VOID> c | [d <VOID>];\n<b> = /1/ one {tag} | /2/ two;", minimize: false},
+		{s: "grammar a;\npublic <a> = [<NULL>] [x] [<NULL>];", minimize: false},
+		{s: "grammar a;\npublic <a> = x | x | x y;", minimize: false},
+		{s: "grammar a;\npublic <list> = <item> [and <list>];\n<item> = tea | coffee;", minimize: false},
+	}
+	for i, test := range table {
+		for r := 1; r <= 3; r++ {
+			o := NewOptions()
+			o.MaxRepeat = r
+			o.MaxDepth = 2
+			o.Minimize = test.minimize
+			g, err := LoadString(test.s, o)
+			if err == nil {
+				g, err = Resolve(g, o)
+			}
+			if err != nil {
+				t.Errorf("test %v: LoadString(%v).err\nGOT %v\nWANT nil", i, test.s, err)
+				break
+			}
+			for k := range maps.Keys(CountRuleProductions(g, o)) {
+				want := getProductions(g.Rules[k], r)
+				for j := 0; j < len(want); j += max(len(want)/50, 1) {
+					prod := want[j]
+					got, err := ProductionAt(g, k, big.NewInt(int64(j)), o)
+					if got != prod || err != nil {
+						t.Errorf("test %v: ProductionAt(%v, %v, %v), MaxRepeat %v\nGOT %q, %v\nWANT %q", i, test.s, k, j, r, got, err, prod)
+					}
+					index, err := IndexOf(g, k, prod, o)
+					if index.Cmp(big.NewInt(int64(slices.Index(want, prod)))) != 0 || err != nil {
+						t.Errorf("test %v: IndexOf(%v, %v, %q), MaxRepeat %v\nGOT %v, %v\nWANT %v", i, test.s, k, prod, r, index, err, slices.Index(want, prod))
+					}
+				}
+				_, err = ProductionAt(g, k, big.NewInt(int64(len(want))), o)
+				if !errors.Is(err, ErrIndexOutOfRange) {
+					t.Errorf("test %v: ProductionAt(%v, %v, %v).err, MaxRepeat %v\nGOT %v\nWANT %v", i, test.s, k, len(want), r, err, ErrIndexOutOfRange)
+				}
+			}
+		}
+	}
+}
+
+func TestProductionAtErrors(t *testing.T) {
+	o := NewOptions()
+	g, _ := LoadString("grammar a;\npublic <a> = (one | two) [three];", o)
+	g, _ = Resolve(g, o)
+	table := []struct {
+		rule string
+		i    int64
+		p    string
+		want error
+	}{
+		{rule: "<a>", i: -1, p: "one", want: ErrIndexOutOfRange},
+		{rule: "<a>", i: 4, p: "", want: ErrIndexOutOfRange},
+		{rule: "<b>", i: 0, p: "one", want: ErrUndefinedRule},
+	}
+	for i, test := range table {
+		_, err := ProductionAt(g, test.rule, big.NewInt(test.i), o)
+		if !errors.Is(err, test.want) {
+			t.Errorf("test %v: ProductionAt(%v, %v).err\nGOT %v\nWANT %v", i, test.rule, test.i, err, test.want)
+		}
+	}
+	for i, p := range []string{"", "one", "three", "one three four", "onethree"} {
+		_, err := IndexOf(g, "<a>", p, o)
+		if !errors.Is(err, ErrProductionNotFound) {
+			t.Errorf("test %v: IndexOf(<a>, %q).err\nGOT %v\nWANT %v", i, p, err, ErrProductionNotFound)
+		}
+	}
+}
+
+func TestIndexOfAmbiguous(t *testing.T) {
+	table := []struct {
+		n int
+		p string
+	}{
+		{n: 22, p: strings.Repeat("a", 21) + "b"},
+		{n: 22, p: strings.Repeat("a", 23)},
+		{n: 60, p: strings.Repeat("a", 59) + "b"},
+	}
+	for i, test := range table {
+		s := "grammar a;\npublic <a> = " + strings.Repeat("(a|a)", test.n) + ";"
+		o := NewOptions()
+		g, err := LoadString(s, o)
+		if err == nil {
+			g, err = Resolve(g, o)
+		}
+		if err != nil {
+			t.Errorf("test %v: LoadString(%v).err\nGOT %v\nWANT nil", i, s, err)
+			continue
+		}
+		_, err = IndexOf(g, "<a>", test.p, o)
+		if !errors.Is(err, ErrProductionNotFound) {
+			t.Errorf("test %v: IndexOf(%v, %q).err\nGOT %v\nWANT %v", i, s, test.p, err, ErrProductionNotFound)
+		}
+		prod, err := ProductionAt(g, "<a>", big.NewInt(0), o)
+		if err == nil {
+			var index *big.Int
+			index, err = IndexOf(g, "<a>", prod, o)
+			if err == nil && index.Sign() != 0 {
+				t.Errorf("test %v: IndexOf(%v, %q)\nGOT %v\nWANT 0", i, s, prod, index)
+			}
+		}
+		if err != nil {
+			t.Errorf("test %v: IndexOf(%v, ProductionAt(0)).err\nGOT %v\nWANT nil", i, s, err)
+		}
+	}
+}
+
+func TestStreamProductionsFrom(t *testing.T) {
+	table := []struct {
+		p string
+		s string
+	}{
+		{p: "data/tests/test7.jsgf"},
+		{p: "data/tests/test0.jsgf"},
+		{s: "grammar a;\npublic <a> = (x | y)+ [z];\n<b> = w;\npublic <c> = <b> | ;\npublic <d> = one | two <b>*;"},
+	}
+	for i, test := range table {
+		var (
+			g   Grammar
+			err error
+		)
+
+		o := NewOptions()
+		switch {
+		case test.p != "":
+			g, err = LoadFile(test.p, o)
+		default:
+			g, err = LoadString(test.s, o)
+		}
+		if err == nil {
+			g, err = Resolve(g, o)
+		}
+		if err != nil {
+			t.Errorf("test %v: Load(%v%v).err\nGOT %v\nWANT nil", i, test.p, test.s, err)
+			continue
+		}
+		all := Productions(g, o)
+		for _, j := range []int{0, 1, 7, len(all) / 2, len(all) - 1, len(all), len(all) + 10} {
+			got := slices.Collect(StreamProductionsFrom(g, big.NewInt(int64(j)), o))
+			want := all[max(min(j, len(all)), 0):]
+			if !slices.Equal(got, want) && len(got)+len(want) > 0 {
+				t.Errorf("test %v: StreamProductionsFrom(%v%v, %v)\nGOT %v %q\nWANT %v %q", i, test.p, test.s, j, len(got), got, len(want), want)
+			}
+		}
+	}
+}
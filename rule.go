@@ -3,10 +3,9 @@
 // Created on Wed Jan 22 08:07:11 PM EST 2025
 // author: Ryan Hildebrandt, github.com/ryancahildebrandt
 
-package main
+package gsgf
 
 import (
-	"errors"
 	"fmt"
 	"regexp"
 	"slices"
@@ -15,12 +14,16 @@ import (
 	"github.com/bzick/tokenizer"
 )
 
-// Contains information for a jsgf rule, including graph, public/private, and base expression
+// Contains information for a jsgf rule, including graph, public/private, doc comment, and base expression
 type Rule struct {
 	Graph
 
 	IsPublic bool
+	Doc      string
 	exp      Expression
+	tree     Node
+	pos      Position
+	tokenPos []Position
 }
 
 func NewRule(e Expression, isPublic bool) Rule {
@@ -31,28 +34,82 @@ func NewRule(e Expression, isPublic bool) Rule {
 	return r
 }
 
+// Returns the syntax tree of the rule's expansion, or nil if the rule has not been parsed
+// Nodes are positioned in the grammar file the rule was read from, if any
+func (r Rule) Expansion() Node {
+	return r.tree
+}
+
+// Parses the expansion of rule r into its syntax tree, and builds the rule's tokens and graph from the tree
+// Returns the rule along with an ErrorList if the expansion is not valid, see parseTokens
+func parseExpansion(r Rule, lex *tokenizer.Tokenizer) (Rule, error) {
+	var err error
+
+	tokens, spans := ToTokenSpans(r.exp, lex)
+	r.Tokens = tokens
+	r.tree, err = parseTokens(tokens, r.tokenPos, referenceTokens(r.exp, tokens, spans))
+	r.Graph = NewGraph(treeEdges(r.tree, r.Tokens), r.Tokens)
+
+	return r, unclosedLiterals(r.exp, tokens, spans, r.tokenPos, getQuoteChar(lex), err)
+}
+
+// Special rules defined by the jsgf spec, available in every grammar
+// - <NULL> always matches and produces nothing
+// - <VOID> never matches, so any path through it is pruned during traversal
+var specialRules map[string]Rule = map[string]Rule{
+	"<NULL>": {
+		exp:   "",
+		Graph: NewGraph(EdgeList{{From: 0, To: 1, Weight: 1.0}}, []Expression{"<SOS>", "<EOS>"}),
+	},
+	"<VOID>": {
+		exp:   "",
+		Graph: NewGraph(EdgeList{{From: 0, To: 1, Weight: 1.0}, {From: 1, To: 2, Weight: 1.0}}, []Expression{"<SOS>", "<VOID>", "<EOS>"}),
+	},
+}
+
+// Checks if the reference r is one of the special rules <NULL> or <VOID>
+func isSpecialRule(r string) bool {
+	_, ok := specialRules[r]
+
+	return ok
+}
+
 // Helper function to pull rule tokens from the nodes of the rule's graph
 func getTokens(r Rule) []Expression {
 	return r.Graph.Tokens
 }
 
-// Returns any rules referenced in a rule definition
+// Returns any rules referenced in a rule definition, in the order they first appear
+// Rules that have not been parsed into a syntax tree are searched for references with a regular expression
 func getReferences(r Rule) []string {
 	var refs []string
 	var seen map[string]struct{} = make(map[string]struct{})
 
-	for _, r := range regexp.MustCompile(`<.*?>`).FindAllString(r.exp, -1) {
-		_, ok := seen[r]
+	add := func(ref string) {
+		_, ok := seen[ref]
 		if !ok {
-			seen[r] = struct{}{}
-			refs = append(refs, r)
+			seen[ref] = struct{}{}
+			refs = append(refs, ref)
 		}
 	}
+	if r.tree == nil {
+		for _, ref := range regexp.MustCompile(`<.*?>`).FindAllString(r.exp, -1) {
+			add(ref)
+		}
+		return refs
+	}
+	Walk(r.tree, func(n Node) bool {
+		ref, ok := n.(*RuleRef)
+		if ok {
+			add(ref.Name)
+		}
+		return true
+	})
 
 	return refs
 }
 
-// Composes graphs of rules referenced by main rule
+// Composes graphs of rules referenced by main rule, including special rules <NULL> and <VOID>
 // Returns error if referenced rule is not availabe
 func ResolveReferences(r Rule, m map[string]Rule, lex *tokenizer.Tokenizer) (Rule, error) {
 	if len(getReferences(r)) == 0 {
@@ -68,15 +125,19 @@ func ResolveReferences(r Rule, m map[string]Rule, lex *tokenizer.Tokenizer) (Rul
 	for k, v := range m {
 		rules[k] = v
 	}
+	for k, v := range specialRules {
+		rules[k] = v
+	}
 	for _, ref := range getReferences(r) {
 		if ref == "" {
 			continue
 		}
-		r2, ok := rules[ref]
-		if !ok {
-			return r, fmt.Errorf("error when calling ResolveReferences(%v, %v, %v), rule %v, ref %v:\n%+w", r, m, lex, rules, ref, errors.New("referenced rule does not exist in grammar"))
+		var key string
+		key, err = resolveReference(ref, rules)
+		if err != nil {
+			return r, fmt.Errorf("in ResolveReferences(%v):\n%+w", r.exp, &SourceError{Pos: tokenPosition(r, ref), Text: ref, Err: err})
 		}
-		r1, err = singleResolveReference(r1, ref, r2, lex)
+		r1, err = singleResolveReference(r1, ref, rules[key], lex)
 		if err != nil {
 			return r1, err
 		}
@@ -85,25 +146,106 @@ func ResolveReferences(r Rule, m map[string]Rule, lex *tokenizer.Tokenizer) (Rul
 	return r1, nil
 }
 
-// Composes a single referenced rule into its parent rule
+// Returns the name of the rule in m that the reference ref points to
+// - Exact matches, such as local rules and fully qualified references <gram.rule>, are returned as is
+// - Unqualified references, and references qualified with a simple grammar name as in <tea.rule>, are matched against the fully qualified names of imported rules
+// Returns an error if the rule does not exist or an unqualified reference matches rules from more than one imported grammar
+func resolveReference(ref string, m map[string]Rule) (string, error) {
+	var matches []string
+
+	_, ok := m[ref]
+	if ok || isSpecialRule(ref) {
+		return ref, nil
+	}
+	for k := range m {
+		if strings.HasSuffix(k, "."+strings.TrimPrefix(ref, "<")) {
+			matches = append(matches, k)
+		}
+	}
+	slices.Sort(matches)
+
+	switch len(matches) {
+	case 0:
+		return ref, fmt.Errorf("error when calling resolveReference(%v):\n%+w", ref, ErrUndefinedRule)
+	case 1:
+		return matches[0], nil
+	default:
+		return ref, fmt.Errorf("error when calling resolveReference(%v), matches %v:\n%+w", ref, matches, ErrAmbiguousReference)
+	}
+}
+
+// Composes a single referenced rule into its parent rule, at each rule reference node of the parent rule's syntax tree
 // Returns an error if graphs cannot be composed
 func singleResolveReference(r Rule, ref string, r1 Rule, lex *tokenizer.Tokenizer) (Rule, error) {
-	var r2 Rule = r
-
-	for i, t := range ToTokens(r2.exp, lex) {
-		if t == ref {
-			g, err := composeGraphs(r2.Graph, r1.Graph, i)
-			if err != nil {
-				return r, err
-			}
-			r2.Graph = g
-			r2.Tokens = g.Tokens
+	var (
+		r2  Rule = r
+		err error
+	)
+
+	if r2.tree == nil {
+		r2, err = parseExpansion(r2, lex)
+		if err != nil {
+			return r, err
+		}
+		r2.Graph, r2.Tokens = r.Graph, r.Tokens
+	}
+	for _, i := range referenceNodes(r2.tree, ref) {
+		g, err := composeGraphs(r2.Graph, r1.Graph, i)
+		if err != nil {
+			return r, fmt.Errorf("in singleResolveReference(%v):\n%+w", ref, &SourceError{Pos: tokenPosition(r, ref), Msg: "cannot compose referenced rule", Text: ref, Err: err})
 		}
+		r2.Graph = g
+		r2.Tokens = g.Tokens
 	}
 
 	return r2, nil
 }
 
+// Returns the token index of each reference to rule ref in the syntax tree n, in the order they appear
+func referenceNodes(n Node, ref string) []int {
+	var res []int
+
+	Walk(n, func(n Node) bool {
+		r, ok := n.(*RuleRef)
+		if ok && r.Name == ref {
+			res = append(res, r.token)
+		}
+		return true
+	})
+
+	return res
+}
+
+// Sets the position of rule r and each of its tokens from the source of the rule statement st
+// The tokens of st are expected to line up with the tokens of r, which holds as long as only rule references in r's expression have been rewritten
+func setRuleSource(r Rule, st source, lex *tokenizer.Tokenizer) Rule {
+	exp := ruleExpansion(st)
+	_, spans := ToTokenSpans(exp.text, lex)
+
+	r.pos = st.position(strings.Index(st.text, "<"))
+	r.tokenPos = make([]Position, len(spans))
+	for i, span := range spans {
+		r.tokenPos[i] = exp.position(span.Start)
+	}
+
+	return r
+}
+
+// Returns the position of the first reference to rule t in rule r, or the position of the rule itself if t is not found
+// Rules that have not been parsed into a syntax tree are searched for the first token equal to t
+func tokenPosition(r Rule, t Expression) Position {
+	i := slices.Index(r.Tokens, t)
+	refs := referenceNodes(r.tree, t)
+	if len(refs) > 0 {
+		i = refs[0]
+	}
+	if i < 0 || i >= len(r.tokenPos) {
+		return r.pos
+	}
+
+	return r.tokenPos[i]
+}
+
 // Splits a jsgf rule statement into its constituent name and rule expression
 // Returns an error if the line is not a valid rule statement
 func ParseRule(line string, lex *tokenizer.Tokenizer) (string, Rule, error) {
@@ -125,21 +267,67 @@ func ParseRule(line string, lex *tokenizer.Tokenizer) (string, Rule, error) {
 	return name, NewRule(exp, strings.HasPrefix(line, "public")), nil
 }
 
-// Checks that a rule does not reference itself either directly or indirectly
+// Checks that a rule does not reference itself either directly or indirectly, following references through all rules in m
+// Returns an error listing the cycle of references if one is found
 func ValidateRuleRecursion(n string, r Rule, m map[string]Rule) error {
-	refs := getReferences(r)
+	var rules map[string]Rule = make(map[string]Rule)
 
-	if len(refs) == 0 {
-		return nil
+	for k, v := range m {
+		rules[k] = v
 	}
-	if slices.Contains(refs, n) {
-		return fmt.Errorf("error when calling ValidateRuleRecursion(%v, %v, %v), references %v:\n%+w", n, r, m, refs, errors.New("rule references self directly"))
+	rules[n] = r
+
+	cycle := getReferenceCycle(n, rules)
+	if len(cycle) > 0 {
+		return fmt.Errorf("error when calling ValidateRuleRecursion(%v):\n%+w", n, cycleError(cycle, rules))
 	}
-	for _, v := range m {
-		if slices.Contains(getReferences(v), n) {
-			return fmt.Errorf("error when calling ValidateRuleRecursion(%v, %v, %v), references %v, rule %v:\n%+w", n, r, m, refs, v, errors.New("rule references self indirectly"))
+
+	return nil
+}
+
+// Returns an error for a cycle of references, positioned at the reference that leads back to the first rule of the cycle
+func cycleError(cycle []string, m map[string]Rule) error {
+	var pos Position = m[cycle[0]].pos
+
+	for _, ref := range getReferences(m[cycle[len(cycle)-2]]) {
+		key, err := resolveReference(ref, m)
+		if err == nil && key == cycle[0] {
+			pos = tokenPosition(m[cycle[len(cycle)-2]], ref)
+			break
 		}
 	}
 
-	return nil
+	return &SourceError{Pos: pos, Text: strings.Join(cycle, " -> "), Err: ErrCyclicReference}
+}
+
+// Returns the first cycle of references reachable from rule n, starting and ending with the same rule name
+// Returns an empty slice if no cycle is found
+func getReferenceCycle(n string, m map[string]Rule) []string {
+	return visitReferences(n, m, []string{}, make(map[string]bool))
+}
+
+// Depth first search over rule references, tracking the current path of rule names and the rules already fully explored
+func visitReferences(n string, m map[string]Rule, path []string, done map[string]bool) []string {
+	i := slices.Index(path, n)
+	if i >= 0 {
+		return append(slices.Clone(path[i:]), n)
+	}
+	if done[n] {
+		return []string{}
+	}
+
+	path = append(path, n)
+	for _, ref := range getReferences(m[n]) {
+		key, err := resolveReference(ref, m)
+		if err != nil || isSpecialRule(key) {
+			continue
+		}
+		cycle := visitReferences(key, m, path, done)
+		if len(cycle) > 0 {
+			return cycle
+		}
+	}
+	done[n] = true
+
+	return []string{}
 }
@@ -3,9 +3,10 @@
 // Created on Wed Jan 22 08:12:02 PM EST 2025
 // author: Ryan Hildebrandt, github.com/ryancahildebrandt
 
-package main
+package gsgf
 
 import (
+	"errors"
 	"slices"
 	"sort"
 	"testing"
@@ -611,6 +612,74 @@ func TestResolveReferences(t *testing.T) {
 	}
 }
 
+func TestResolveReference(t *testing.T) {
+	m := map[string]Rule{
+		"<a>":       NewRule("123;", false),
+		"<x.a>":     NewRule("123;", false),
+		"<x.b>":     NewRule("1|2|3;", false),
+		"<y.b>":     NewRule("1|2|3;", false),
+		"<y.c>":     NewRule("1[2]3;", false),
+		"<x.y.d>":   NewRule("1(2)3;", false),
+		"<z.y.d.e>": NewRule("1(2)3;", false),
+	}
+	table := []struct {
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{ref: "<a>", want: "<a>", wantErr: false},
+		{ref: "<x.a>", want: "<x.a>", wantErr: false},
+		{ref: "<x.b>", want: "<x.b>", wantErr: false},
+		{ref: "<y.b>", want: "<y.b>", wantErr: false},
+		{ref: "<b>", want: "<b>", wantErr: true},
+		{ref: "<c>", want: "<y.c>", wantErr: false},
+		{ref: "<d>", want: "<x.y.d>", wantErr: false},
+		{ref: "<e>", want: "<z.y.d.e>", wantErr: false},
+		{ref: "<y.d>", want: "<x.y.d>", wantErr: false},
+		{ref: "<y.d.e>", want: "<z.y.d.e>", wantErr: false},
+		{ref: "<x.d>", want: "<x.d>", wantErr: true},
+		{ref: "<z.c>", want: "<z.c>", wantErr: true},
+		{ref: "<f>", want: "<f>", wantErr: true},
+		{ref: "<NULL>", want: "<NULL>", wantErr: false},
+		{ref: "<VOID>", want: "<VOID>", wantErr: false},
+	}
+	for i, test := range table {
+		got, err := resolveReference(test.ref, m)
+		if got != test.want {
+			t.Errorf("test %v: resolveReference(%v)\nGOT %v\nWANT %v", i, test.ref, got, test.want)
+		}
+		if (err != nil) != test.wantErr {
+			t.Errorf("test %v: resolveReference(%v).err\nGOT %v\nWANT %v", i, test.ref, err, test.wantErr)
+		}
+	}
+}
+
+func TestSingleResolveReferenceError(t *testing.T) {
+	lexer := NewJSGFLexer("\"")
+	table := []struct {
+		exp  string
+		ref  string
+		r1   Rule
+		want string
+	}{
+		{exp: "x <e>;", ref: "<e>", r1: Rule{}, want: "cannot compose referenced rule <e>"},
+		{exp: "x [<e> y];", ref: "<e>", r1: Rule{}, want: "cannot compose referenced rule <e>"},
+	}
+	for i, test := range table {
+		var se *SourceError
+
+		r, err := parseExpansion(NewRule(test.exp, true), lexer)
+		if err != nil {
+			t.Errorf("test %v: parseExpansion(%v).err\nGOT %v\nWANT nil", i, test.exp, err)
+			continue
+		}
+		_, err = singleResolveReference(r, test.ref, test.r1, lexer)
+		if !errors.As(err, &se) || se.Error() != test.want {
+			t.Errorf("test %v: singleResolveReference(%v, %v).err\nGOT %v\nWANT %v", i, test.exp, test.ref, err, test.want)
+		}
+	}
+}
+
 func TestParseRule(t *testing.T) {
 	lexer := NewJSGFLexer("\"")
 	table := []struct {
@@ -663,10 +732,21 @@ func TestParseRule(t *testing.T) {
 }
 
 func TestGetReferences(t *testing.T) {
+	lexer := NewJSGFLexer("\"")
+	parsed := func(e string) Rule {
+		r, _ := parseExpansion(NewRule(e, false), lexer)
+		return r
+	}
 	tests := []struct {
 		r    Rule
 		want []string
 	}{
+		{r: parsed(""), want: []string{}},
+		{r: parsed("test expression 123 <rule1> [<rule2> | <rule1>]*;"), want: []string{"<rule1>", "<rule2>"}},
+		{r: parsed("test \"<rule>\" 123;"), want: []string{}},
+		{r: parsed("say \"<rule>\";"), want: []string{}},
+		{r: parsed("\"<rule>\" [and <rule>];"), want: []string{"<rule>"}},
+		{r: Rule{exp: "test \"<rule>\" 123;"}, want: []string{"<rule>"}},
 		{r: Rule{exp: "", IsPublic: false}, want: []string{}},
 		{r: Rule{exp: "", IsPublic: true}, want: []string{}},
 		{r: Rule{exp: ";", IsPublic: false}, want: []string{}},
@@ -784,7 +864,10 @@ func TestValidateRuleRecursion(t *testing.T) {
 		{n: "<rule>", e: "<rule><rule1>;", wantErr: true},
 		{n: "<d>", e: "abc<c>;", wantErr: true},
 		{n: "<b>", e: "123<e>;", wantErr: true},
-		{n: "<e>", e: "<a><a>;", wantErr: true},
+		{n: "<e>", e: "<a><a>;", wantErr: false},
+		{n: "<e>", e: "<a><c>;", wantErr: true},
+		{n: "<a>", e: "<NULL><VOID>;", wantErr: false},
+		{n: "<rule>", e: "<c>;", wantErr: false},
 	}
 	for i, test := range tests {
 		err := ValidateRuleRecursion(test.n, NewRule(test.e, false), m)